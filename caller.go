@@ -0,0 +1,161 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// A SourceFormat determines how the Source of a record is derived from the
+// code which logged it.
+type SourceFormat int
+
+const (
+	SOURCE_FUNC  SourceFormat = iota // Function and line, e.g. main.main:12 (the default)
+	SOURCE_SHORT                     // File name and line, e.g. main.go:12
+	SOURCE_FULL                      // Full path of the file and line, e.g. /src/cmd/main.go:12
+	SOURCE_NONE                      // Don't look up the caller at all; Source is empty
+)
+
+// WithCallerSkip returns a copy of log which skips a further skip stack frames
+// when looking up the caller to use as the Source of a record.  This is useful
+// for helpers which wrap a Logger, so that records are attributed to the
+// helper's caller rather than the helper itself:
+//
+//	var logger = log4go.GetLogger("app").WithCallerSkip(1)
+//
+//	func logRequest(r *http.Request) {
+//		logger.Info("%s %s", r.Method, r.URL)
+//	}
+func (log Logger) WithCallerSkip(skip int) Logger {
+	log.callerSkip = skip
+	return log
+}
+
+// WithSourceFormat returns a copy of log which derives the Source of each
+// record from its caller according to format.  SOURCE_NONE turns off looking
+// up the caller, which saves time on every call.  The %N, %s and %C format
+// codes render the function, file name and full path of the caller regardless
+// of the format, as long as the caller was looked up.
+func (log Logger) WithSourceFormat(format SourceFormat) Logger {
+	log.sourceFormat = format
+	return log
+}
+
+// Look up the caller of the Logger method which called intLogf or intLogc,
+// returning its program counter and the Source of its records.
+func (log Logger) caller() (uintptr, string) {
+	if log.sourceFormat == SOURCE_NONE {
+		return 0, ""
+	}
+
+	// Skip runtime.Callers, caller, intLogf and the Logger method
+	var pcs [1]uintptr
+	if runtime.Callers(4+log.callerSkip, pcs[:]) == 0 {
+		return 0, ""
+	}
+	return pcs[0], log.cachedSource(pcs[0])
+}
+
+// The Sources of the callers seen so far, by source format and program counter
+var sourceCache [SOURCE_NONE]struct {
+	sync.RWMutex
+	sources map[uintptr]string
+}
+
+// Return the Source of a record logged from pc, which is only formatted the
+// first time it is seen
+func (log Logger) cachedSource(pc uintptr) string {
+	if log.sourceFormat < 0 || log.sourceFormat >= SOURCE_NONE {
+		return log.source(callerFrame(pc))
+	}
+	cache := &sourceCache[log.sourceFormat]
+	cache.RLock()
+	src, ok := cache.sources[pc]
+	cache.RUnlock()
+	if ok {
+		return src
+	}
+
+	src = log.source(callerFrame(pc))
+	cache.Lock()
+	if cache.sources == nil {
+		cache.sources = make(map[uintptr]string)
+	}
+	cache.sources[pc] = src
+	cache.Unlock()
+	return src
+}
+
+// Format the Source of a record logged from frame
+func (log Logger) source(frame runtime.Frame) string {
+	switch log.sourceFormat {
+	case SOURCE_SHORT:
+		return filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+	case SOURCE_FULL:
+		return frame.File + ":" + strconv.Itoa(frame.Line)
+	}
+	return frame.Function + ":" + strconv.Itoa(frame.Line)
+}
+
+// The number of records dispatched, for the %R format code (accessed atomically)
+var sequence uint64
+
+// Set once a format uses the %G format code, after which the goroutine which
+// logged each record is looked up (accessed atomically)
+var goroutineIDs int32
+
+// Buffers for the start of the stack traces read by goroutineID, which would
+// otherwise be allocated on every call
+var stackHeaderPool = sync.Pool{
+	New: func() interface{} { return new([64]byte) },
+}
+
+// Returns the ID of the calling goroutine, parsed from the header of its stack
+// trace: "goroutine 123 [running]:"
+func goroutineID() uint64 {
+	buf := stackHeaderPool.Get().(*[64]byte)
+	defer stackHeaderPool.Put(buf)
+
+	stack := buf[:runtime.Stack(buf[:], false)]
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	var id uint64
+	for _, c := range stack {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + uint64(c-'0')
+	}
+	return id
+}
+
+// Resolve a program counter returned by runtime.Callers, accounting for inlining
+func callerFrame(pc uintptr) runtime.Frame {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	return frame
+}
+
+// Write the function, file name or full path of the caller, and for the latter
+// two the line number, for the %N, %s and %C format codes.
+func (rec *LogRecord) writeCaller(out *bytes.Buffer, code byte) {
+	if rec.pc == 0 {
+		return
+	}
+	frame := callerFrame(rec.pc)
+	switch code {
+	case 'N':
+		out.WriteString(frame.Function)
+	case 's':
+		out.WriteString(filepath.Base(frame.File))
+		out.WriteByte(':')
+		out.WriteString(strconv.Itoa(frame.Line))
+	case 'C':
+		out.WriteString(frame.File)
+		out.WriteByte(':')
+		out.WriteString(strconv.Itoa(frame.Line))
+	}
+}
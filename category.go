@@ -0,0 +1,194 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The level of a category which inherits the level of its parent
+const noLevel = math.MinInt32
+
+// A category is the state shared by a Logger and all of its copies.  Named
+// categories form a tree below the root category returned by NewLogger, where
+// "db.pool" is a child of "db", which is a child of the root.  Records logged
+// to a category are written to its own Filters and to those of all of its
+// ancestors.
+type category struct {
+	name   string
+	parent *category
+
+	// The current map[string]*Filter.  The map is replaced rather than
+	// modified, so it can be read without locking while records are logged.
+	filters atomic.Value
+
+	// The current []Hook, which is also replaced rather than modified
+	hooks atomic.Value
+
+	// Number of records logged to this category, by Level (*uint64, accessed
+	// atomically)
+	counts sync.Map
+
+	// Minimum level for records logged to this category and, unless they
+	// override it, to its descendants, or noLevel (accessed atomically)
+	level int32
+
+	// Guards replacement of the filters and hooks, and the registry of every named
+	// category in the tree (root only)
+	lock  sync.Mutex
+	named map[string]*category
+}
+
+func newCategory(name string, parent *category) *category {
+	c := &category{
+		name:   name,
+		parent: parent,
+		level:  noLevel,
+	}
+	c.filters.Store(map[string]*Filter{})
+	return c
+}
+
+// Returns the current filters, which must not be modified
+func (c *category) loadFilters() map[string]*Filter {
+	return c.filters.Load().(map[string]*Filter)
+}
+
+// Atomically replace the filters with the result of calling update on a copy
+// of the current ones, returning the previous filters
+func (c *category) updateFilters(update func(filters map[string]*Filter)) map[string]*Filter {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	old := c.loadFilters()
+	filters := make(map[string]*Filter, len(old)+1)
+	for name, filt := range old {
+		filters[name] = filt
+	}
+	update(filters)
+	c.filters.Store(filters)
+	return old
+}
+
+// Walk up to the root of the tree
+func (c *category) root() *category {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c
+}
+
+// Find the category with the given name, creating it and any missing
+// ancestors if necessary.  The empty name refers to the root.
+func (c *category) lookup(name string) *category {
+	root := c.root()
+	name = strings.Trim(name, ".")
+	if len(name) == 0 {
+		return root
+	}
+
+	root.lock.Lock()
+	defer root.lock.Unlock()
+
+	if root.named == nil {
+		root.named = make(map[string]*category)
+	}
+	if cat, ok := root.named[name]; ok {
+		return cat
+	}
+
+	parent := root
+	for i := 0; i <= len(name); i++ {
+		if i < len(name) && name[i] != '.' {
+			continue
+		}
+		prefix := name[:i]
+		cat, ok := root.named[prefix]
+		if !ok {
+			cat = newCategory(prefix, parent)
+			root.named[prefix] = cat
+		}
+		parent = cat
+	}
+	return parent
+}
+
+// Return this category and every category below it in the tree
+func (c *category) subtree() []*category {
+	root := c.root()
+	cats := []*category{c}
+
+	root.lock.Lock()
+	defer root.lock.Unlock()
+
+	for _, cat := range root.named {
+		for p := cat.parent; p != nil; p = p.parent {
+			if p == c {
+				cats = append(cats, cat)
+				break
+			}
+		}
+	}
+	return cats
+}
+
+// Returns the level set on the nearest category up the tree, if any
+func (c *category) effectiveLevel() (Level, bool) {
+	for ; c != nil; c = c.parent {
+		if lvl := atomic.LoadInt32(&c.level); lvl != noLevel {
+			return Level(lvl), true
+		}
+	}
+	return FINEST, false
+}
+
+// Set or clear (with noLevel) the level of the category
+func (c *category) setLevel(lvl int32) {
+	atomic.StoreInt32(&c.level, lvl)
+}
+
+// Name returns the dotted name of the Logger, which is empty for the root.
+func (log Logger) Name() string {
+	return log.name
+}
+
+// GetLogger returns the Logger with the given dotted name (e.g. "db.pool") in
+// the same hierarchy as log, creating it if necessary.  Names are always
+// relative to the root, so every Logger in a hierarchy returns the same named
+// Logger for the same name.
+//
+// Records logged to a named Logger are written to its own Filters and to those
+// of its ancestors.  Use SetLoggerLevel to discard records below a level for a
+// part of the hierarchy.
+//
+// The returned Logger keeps the Fields, caller settings and stack level of log,
+// so e.g. log.With("request", id).GetLogger("db") attaches the request to the
+// records of "db".
+func (log Logger) GetLogger(name string) Logger {
+	log.category = log.lookup(name)
+	return log
+}
+
+// SetLoggerLevel sets the minimum level of records logged to the named Logger
+// and those below it which do not set their own level.  Records below the level
+// are discarded before they reach any Filter.  The empty name sets the level of
+// the root.  It is safe to call while other goroutines are logging.
+func (log Logger) SetLoggerLevel(name string, lvl Level) {
+	log.lookup(name).setLevel(int32(lvl))
+}
+
+// ClearLoggerLevel removes any level set on the named Logger, so that it again
+// inherits the level of its parent.
+func (log Logger) ClearLoggerLevel(name string) {
+	log.lookup(name).setLevel(noLevel)
+}
+
+// EffectiveLevel returns the level inherited by log from the nearest Logger
+// in its hierarchy which has one set, or FINEST if none do.
+func (log Logger) EffectiveLevel() Level {
+	lvl, _ := log.effectiveLevel()
+	return lvl
+}
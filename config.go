@@ -7,9 +7,12 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type xmlProperty struct {
@@ -17,21 +20,47 @@ type xmlProperty struct {
 	Value string `xml:",chardata"`
 }
 
+type xmlMatch struct {
+	Field   string `xml:"field,attr"`
+	Exclude string `xml:"exclude,attr"`
+	Pattern string `xml:",chardata"`
+}
+
 type xmlFilter struct {
 	Enabled  string        `xml:"enabled,attr"`
 	Tag      string        `xml:"tag"`
 	Level    string        `xml:"level"`
+	MaxLevel string        `xml:"maxlevel"`
 	Type     string        `xml:"type"`
+	Match    []xmlMatch    `xml:"match"`
 	Property []xmlProperty `xml:"property"`
 }
 
+type xmlLogger struct {
+	Name  string   `xml:"name,attr"`
+	Level string   `xml:"level"`
+	Hook  []string `xml:"hook"`
+}
+
 type xmlLoggerConfig struct {
 	Filter []xmlFilter `xml:"filter"`
+	Logger []xmlLogger `xml:"logger"`
+	Hook   []string    `xml:"hook"`
 }
 
-// Load XML configuration; see examples/example.xml for documentation
+// Load XML configuration; see examples/example.xml for documentation.
+//
+// The configuration replaces the logging set up on log and on the named Loggers
+// below it: their filters are closed and removed, and their levels and hooks
+// are cleared.  This includes levels set with SetLoggerLevel and hooks added
+// with AddHook in code, such as a Redactor, which must be set again after the
+// configuration has been loaded.
 func (log Logger) LoadConfiguration(filename string) {
 	log.Close()
+	for _, cat := range log.subtree() {
+		cat.setLevel(noLevel)
+		Logger{category: cat}.ClearHooks()
+	}
 
 	// Open the configuration file
 	fd, err := os.Open(filename)
@@ -55,6 +84,9 @@ func (log Logger) LoadConfiguration(filename string) {
 	for _, xmlfilt := range xc.Filter {
 		var filt LogWriter
 		var lvl Level
+		var maxlvl Level = math.MaxInt32
+		var preds []Predicate
+		var err error
 		bad, good, enabled := false, true, false
 
 		// Check required children
@@ -77,27 +109,19 @@ func (log Logger) LoadConfiguration(filename string) {
 			bad = true
 		}
 
-		switch xmlfilt.Level {
-		case "FINEST":
-			lvl = FINEST
-		case "FINE":
-			lvl = FINE
-		case "DEBUG":
-			lvl = DEBUG
-		case "TRACE":
-			lvl = TRACE
-		case "INFO":
-			lvl = INFO
-		case "WARNING":
-			lvl = WARNING
-		case "ERROR":
-			lvl = ERROR
-		case "CRITICAL":
-			lvl = CRITICAL
-		default:
+		if lvl, err = ParseLevel(xmlfilt.Level); err != nil {
 			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter has unknown value in %s: %s\n", "level", filename, xmlfilt.Level)
 			bad = true
 		}
+		if len(xmlfilt.MaxLevel) > 0 {
+			if maxlvl, err = ParseLevel(xmlfilt.MaxLevel); err != nil {
+				fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Child <%s> for filter has unknown value in %s: %s\n", "maxlevel", filename, xmlfilt.MaxLevel)
+				bad = true
+			}
+		}
+		if preds, good = xmlToPredicates(filename, xmlfilt.Match); !good {
+			bad = true
+		}
 
 		// Just so all of the required attributes are errored at the same time if missing
 		if bad {
@@ -108,22 +132,26 @@ func (log Logger) LoadConfiguration(filename string) {
 			xmlfilt.Property[i].Value = substituteEnv(xmlfilt.Property[i].Value)
 		}
 
+		props, wrappers, wrappersGood := xmlToWrappers(filename, xmlfilt.Property)
+
 		switch xmlfilt.Type {
 		case "console":
-			filt, good = xmlToConsoleLogWriter(filename, xmlfilt.Property, enabled)
+			filt, good = xmlToConsoleLogWriter(filename, props, enabled)
 		case "file":
-			filt, good = xmlToFileLogWriter(filename, xmlfilt.Property, enabled)
+			filt, good = xmlToFileLogWriter(filename, props, enabled)
 		case "xml":
-			filt, good = xmlToXMLLogWriter(filename, xmlfilt.Property, enabled)
+			filt, good = xmlToXMLLogWriter(filename, props, enabled)
+		case "json", "logfmt":
+			filt, good = xmlToFormatterLogWriter(filename, xmlfilt.Type, props, enabled)
 		case "socket":
-			filt, good = xmlToSocketLogWriter(filename, xmlfilt.Property, enabled)
+			filt, good = xmlToSocketLogWriter(filename, props, enabled)
 		default:
 			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not load XML configuration in %s: unknown filter type \"%s\"\n", filename, xmlfilt.Type)
 			os.Exit(1)
 		}
 
 		// Just so all of the required params are errored at the same time if wrong
-		if !good {
+		if !good || !wrappersGood {
 			os.Exit(1)
 		}
 
@@ -132,8 +160,98 @@ func (log Logger) LoadConfiguration(filename string) {
 			continue
 		}
 
-		log[xmlfilt.Tag] = &Filter{lvl, filt}
+		filt = wrappers.wrap(filt)
+
+		filter := NewFilter(lvl, filt)
+		filter.SetMaxLevel(maxlvl)
+		for _, pred := range preds {
+			filter.AddPredicate(pred)
+		}
+		log.SetFilter(xmlfilt.Tag, filter)
+	}
+
+	hooks, good := xmlToHooks(filename, xc.Hook)
+	if !good {
+		os.Exit(1)
 	}
+	for _, hook := range hooks {
+		log.AddHook(hook)
+	}
+
+	for _, xmllog := range xc.Logger {
+		bad := false
+		var lvl Level
+		var err error
+		if len(xmllog.Level) > 0 {
+			if lvl, err = ParseLevel(xmllog.Level); err != nil {
+				fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Child <%s> for logger %q has unknown value in %s: %s\n", "level", xmllog.Name, filename, xmllog.Level)
+				bad = true
+			}
+		}
+		hooks, good := xmlToHooks(filename, xmllog.Hook)
+		if bad || !good {
+			os.Exit(1)
+		}
+
+		named := log.GetLogger(xmllog.Name)
+		if len(xmllog.Level) > 0 {
+			log.SetLoggerLevel(xmllog.Name, lvl)
+		}
+		for _, hook := range hooks {
+			named.AddHook(hook)
+		}
+	}
+}
+
+// Look up the hooks named by <hook> elements, which must have been registered
+// with RegisterHook
+func xmlToHooks(filename string, names []string) ([]Hook, bool) {
+	var hooks []Hook
+	good := true
+	for _, name := range names {
+		name = strings.Trim(name, " \r\n")
+		hook, ok := lookupHook(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Unknown hook %q in %s\n", name, filename)
+			good = false
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, good
+}
+
+// Convert the <match> children of a filter into Predicates.  Each <match>
+// holds a regular expression which the "source" or "message" (the default) of
+// a record must match, or must not match if its exclude attribute is "true".
+func xmlToPredicates(filename string, matches []xmlMatch) ([]Predicate, bool) {
+	var preds []Predicate
+	good := true
+	for _, match := range matches {
+		re, err := regexp.Compile(strings.Trim(match.Pattern, " \r\n"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not compile <%s> pattern %q in %s: %s\n", "match", match.Pattern, filename, err)
+			good = false
+			continue
+		}
+
+		var pred Predicate
+		switch match.Field {
+		case "source":
+			pred = SourceMatches(re)
+		case "message", "":
+			pred = MessageMatches(re)
+		default:
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Unknown field %q for <%s> in %s\n", match.Field, "match", filename)
+			good = false
+			continue
+		}
+		if match.Exclude == "true" {
+			pred = Not(pred)
+		}
+		preds = append(preds, pred)
+	}
+	return preds, good
 }
 
 /*
@@ -190,21 +308,190 @@ func substituteEnv(prop string) string {
 	return propBuilder.String()
 }
 
+// The writer decorators which can be configured for any type of filter
+type xmlWrappers struct {
+	sampleInterval   time.Duration
+	sampleFirst      int
+	sampleThereafter int
+	dedup            bool
+	dedupTimeout     time.Duration
+	redactor         *Redactor
+}
+
+// Separate the properties which configure writer decorators from those of the
+// filter's writer:
+//
+//	samplefirst       Enables sampling: records of each level written per interval
+//	samplethereafter  Then write every Nth record of the level (default 0, none)
+//	sampleinterval    The sampling interval (default 1s)
+//	dedup             Collapse repeated records (true/false, default false)
+//	deduptimeout      Report repeated records at least this often (default 30s)
+//	redact            Mask secrets with the built-in detectors: "true" for all of
+//	                  them, or a comma-separated list such as "password,email"
+//	redactpattern     Mask the matches of a regular expression (may be repeated)
+func xmlToWrappers(filename string, props []xmlProperty) ([]xmlProperty, *xmlWrappers, bool) {
+	wrappers := &xmlWrappers{
+		sampleInterval: time.Second,
+		sampleFirst:    -1,
+		dedupTimeout:   30 * time.Second,
+	}
+	rest := make([]xmlProperty, 0, len(props))
+	good := true
+
+	for _, prop := range props {
+		value := strings.Trim(prop.Value, " \r\n")
+		switch prop.Name {
+		case "samplefirst", "samplethereafter":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Property \"%s\" has invalid count in %s: %s\n", prop.Name, filename, value)
+				good = false
+			} else if prop.Name == "samplefirst" {
+				wrappers.sampleFirst = n
+			} else {
+				wrappers.sampleThereafter = n
+			}
+		case "sampleinterval":
+			interval, err := time.ParseDuration(value)
+			if err != nil || interval <= 0 {
+				fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Property \"%s\" has invalid duration in %s: %s\n", prop.Name, filename, value)
+				good = false
+			}
+			wrappers.sampleInterval = interval
+		case "dedup":
+			wrappers.dedup = value != "false"
+		case "deduptimeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout < 0 {
+				fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Property \"%s\" has invalid duration in %s: %s\n", prop.Name, filename, value)
+				good = false
+			}
+			wrappers.dedupTimeout = timeout
+		case "redact":
+			var detectors []string
+			switch value {
+			case "false":
+				continue
+			case "true":
+			default:
+				detectors = strings.Split(value, ",")
+			}
+			redactor, err := NewRedactor(detectors...)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Property \"%s\" has unknown detector in %s: %s\n", prop.Name, filename, value)
+				good = false
+				continue
+			}
+			if wrappers.redactor != nil {
+				redactor.rules = append(redactor.rules, wrappers.redactor.rules...)
+			}
+			wrappers.redactor = redactor
+		case "redactpattern":
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Property \"%s\" has invalid regular expression in %s: %s\n", prop.Name, filename, err)
+				good = false
+				continue
+			}
+			if wrappers.redactor == nil {
+				wrappers.redactor = &Redactor{}
+			}
+			wrappers.redactor.AddPattern(pattern)
+		default:
+			rest = append(rest, prop)
+		}
+	}
+	return rest, wrappers, good
+}
+
+// Wrap a filter's writer in the configured decorators
+func (wrappers *xmlWrappers) wrap(w LogWriter) LogWriter {
+	if wrappers.sampleFirst >= 0 {
+		w = NewSamplingLogWriter(w, wrappers.sampleInterval, wrappers.sampleFirst, wrappers.sampleThereafter)
+	}
+	// Collapse repeats before sampling, so that they don't count towards it
+	if wrappers.dedup {
+		w = NewDedupLogWriter(w, wrappers.dedupTimeout)
+	}
+	// Redact first, so that secrets never reach the other decorators
+	if wrappers.redactor != nil {
+		w = NewRedactingLogWriter(w, wrappers.redactor)
+	}
+	return w
+}
+
+// The overflow properties shared by every writer type
+type xmlOverflow struct {
+	policy  OverflowPolicy
+	timeout time.Duration
+}
+
+// Parse the "overflow" (block, dropnewest, dropoldest or timeout) and
+// "overflowtimeout" (e.g. 100ms) properties of a writer.  Returns false if the
+// property is not an overflow property.
+func (o *xmlOverflow) parse(filename string, prop xmlProperty, good *bool) bool {
+	value := strings.Trim(prop.Value, " \r\n")
+	switch prop.Name {
+	case "overflow":
+		switch strings.ToLower(value) {
+		case "block":
+			o.policy = OVERFLOW_BLOCK
+		case "dropnewest":
+			o.policy = OVERFLOW_DROP_NEWEST
+		case "dropoldest":
+			o.policy = OVERFLOW_DROP_OLDEST
+		case "timeout":
+			o.policy = OVERFLOW_TIMEOUT
+		default:
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Property \"%s\" has unknown value in %s: %s\n", prop.Name, filename, value)
+			*good = false
+		}
+	case "overflowtimeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Property \"%s\" has invalid duration in %s: %s\n", prop.Name, filename, value)
+			*good = false
+		}
+		o.timeout = timeout
+	default:
+		return false
+	}
+	return true
+}
+
 func xmlToConsoleLogWriter(filename string, props []xmlProperty, enabled bool) (ConsoleLogWriter, bool) {
+	var formatter Formatter
+	var overflow xmlOverflow
+	good := true
+
 	// Parse properties
 	for _, prop := range props {
+		if overflow.parse(filename, prop, &good) {
+			continue
+		}
 		switch prop.Name {
+		case "formatter":
+			value := strings.Trim(prop.Value, " \r\n")
+			if formatter, _ = xmlToFormatter(value); formatter == nil {
+				fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Property \"%s\" has unknown value in %s: %s\n", prop.Name, filename, value)
+				good = false
+			}
 		default:
 			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for console filter in %s\n", prop.Name, filename)
 		}
 	}
 
 	// If it's disabled, we're just checking syntax
-	if !enabled {
-		return nil, true
+	if !good || !enabled {
+		return nil, good
 	}
 
-	return NewConsoleLogWriter(), true
+	clw := NewConsoleLogWriter()
+	if formatter != nil {
+		clw.SetFormatter(formatter)
+	}
+	clw.SetOverflowPolicy(overflow.policy, overflow.timeout)
+	return clw, true
 }
 
 // Parse a number with K/M/G suffixes based on thousands (1000) or 2^10 (1024)
@@ -235,9 +522,14 @@ func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*Fi
 	rotate := false
 	rotateOnStartup := true
 	dateSuffix := false
+	var overflow xmlOverflow
+	good := true
 
 	// Parse properties
 	for _, prop := range props {
+		if overflow.parse(filename, prop, &good) {
+			continue
+		}
 		switch prop.Name {
 		case "filename":
 			file = strings.Trim(prop.Value, " \r\n")
@@ -267,8 +559,8 @@ func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*Fi
 	}
 
 	// If it's disabled, we're just checking syntax
-	if !enabled {
-		return nil, true
+	if !good || !enabled {
+		return nil, good
 	}
 
 	flw := NewFileLogWriter(file, rotate, false)
@@ -281,6 +573,7 @@ func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*Fi
 	flw.SetRotateDaily(daily)
 	flw.SetRotateDateSuffix(dateSuffix)
 	flw.SetRotateOnStartup(rotateOnStartup)
+	flw.SetOverflowPolicy(overflow.policy, overflow.timeout)
 	return flw, true
 }
 
@@ -290,9 +583,14 @@ func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*Fil
 	maxsize := 0
 	daily := false
 	rotate := false
+	var overflow xmlOverflow
+	good := true
 
 	// Parse properties
 	for _, prop := range props {
+		if overflow.parse(filename, prop, &good) {
+			continue
+		}
 		switch prop.Name {
 		case "filename":
 			file = strings.Trim(prop.Value, " \r\n")
@@ -316,8 +614,8 @@ func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*Fil
 	}
 
 	// If it's disabled, we're just checking syntax
-	if !enabled {
-		return nil, true
+	if !good || !enabled {
+		return nil, good
 	}
 
 	xlw := NewXMLLogWriter(file, rotate)
@@ -327,15 +625,75 @@ func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*Fil
 	xlw.SetRotateLines(maxrecords)
 	xlw.SetRotateSize(maxsize)
 	xlw.SetRotateDaily(daily)
+	xlw.SetOverflowPolicy(overflow.policy, overflow.timeout)
 	return xlw, true
 }
 
-func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (SocketLogWriter, bool) {
+// Returns a Formatter of the named kind ("json" or "logfmt"), and its keys by
+// the names of the properties which set them
+func xmlToFormatter(kind string) (Formatter, map[string]*string) {
+	switch kind {
+	case "json":
+		f := NewJSONFormatter()
+		return f, map[string]*string{
+			"timekey":    &f.TimeKey,
+			"levelkey":   &f.LevelKey,
+			"sourcekey":  &f.SourceKey,
+			"messagekey": &f.MessageKey,
+			"stackkey":   &f.StackKey,
+		}
+	case "logfmt":
+		f := NewLogfmtFormatter()
+		return f, map[string]*string{
+			"timekey":    &f.TimeKey,
+			"levelkey":   &f.LevelKey,
+			"sourcekey":  &f.SourceKey,
+			"messagekey": &f.MessageKey,
+			"stackkey":   &f.StackKey,
+		}
+	}
+	return nil, nil
+}
+
+// A json or logfmt filter is a file filter which writes records with a
+// JSONFormatter or LogfmtFormatter, and takes the keys of its entries as
+// properties
+func xmlToFormatterLogWriter(filename, kind string, props []xmlProperty, enabled bool) (*FileLogWriter, bool) {
+	formatter, keys := xmlToFormatter(kind)
+	var rest []xmlProperty
+
+	// Parse properties
+	for _, prop := range props {
+		if key, ok := keys[prop.Name]; ok {
+			*key = strings.Trim(prop.Value, " \r\n")
+			continue
+		}
+		if prop.Name == "format" {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for %s filter in %s\n", prop.Name, kind, filename)
+			continue
+		}
+		rest = append(rest, prop)
+	}
+
+	flw, good := xmlToFileLogWriter(filename, rest, enabled)
+	if flw == nil {
+		return nil, good
+	}
+	flw.SetFormatter(formatter)
+	return flw, good
+}
+
+func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (*SocketLogWriter, bool) {
 	endpoint := ""
 	protocol := "udp"
+	var overflow xmlOverflow
+	good := true
 
 	// Parse properties
 	for _, prop := range props {
+		if overflow.parse(filename, prop, &good) {
+			continue
+		}
 		switch prop.Name {
 		case "endpoint":
 			endpoint = strings.Trim(prop.Value, " \r\n")
@@ -353,9 +711,14 @@ func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (S
 	}
 
 	// If it's disabled, we're just checking syntax
-	if !enabled {
-		return nil, true
+	if !good || !enabled {
+		return nil, good
 	}
 
-	return NewSocketLogWriter(protocol, endpoint), true
+	slw := NewSocketLogWriter(protocol, endpoint)
+	if slw == nil {
+		return nil, false
+	}
+	slw.SetOverflowPolicy(overflow.policy, overflow.timeout)
+	return slw, true
 }
@@ -0,0 +1,287 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A ContextExtractor pulls values out of a context.Context so that they can be
+// attached to a LogRecord as Fields.  It should return nil if the context holds
+// nothing of interest.
+type ContextExtractor func(ctx context.Context) Fields
+
+var contextExtractors struct {
+	sync.RWMutex
+	list []ContextExtractor
+}
+
+// RegisterContextExtractor adds an extractor which is consulted by every *Ctx
+// logging method.  Extractors run in the order in which they were registered,
+// and only when the record will actually be written.
+func RegisterContextExtractor(ext ContextExtractor) {
+	contextExtractors.Lock()
+	defer contextExtractors.Unlock()
+	contextExtractors.list = append(contextExtractors.list, ext)
+}
+
+// ClearContextExtractors removes every registered extractor, e.g. so that a
+// test can restore the state it found.
+func ClearContextExtractors() {
+	contextExtractors.Lock()
+	defer contextExtractors.Unlock()
+	contextExtractors.list = nil
+}
+
+// ContextValue returns a ContextExtractor which attaches the value stored in the
+// context under key as a field called name.  Nothing is attached if the context
+// has no such value.
+func ContextValue(name string, key interface{}) ContextExtractor {
+	return func(ctx context.Context) Fields {
+		if value := ctx.Value(key); value != nil {
+			return Fields{{name, value}}
+		}
+		return nil
+	}
+}
+
+// ContextDeadline returns a ContextExtractor which attaches the time remaining
+// until the context's deadline as a field called name.  Nothing is attached if
+// the context has no deadline.
+func ContextDeadline(name string) ContextExtractor {
+	return func(ctx context.Context) Fields {
+		if deadline, ok := ctx.Deadline(); ok {
+			return Fields{{name, deadline.Sub(time.Now())}}
+		}
+		return nil
+	}
+}
+
+// Returns a Logger with the fields of every registered extractor attached
+func (log Logger) withContext(ctx context.Context) Logger {
+	if ctx == nil {
+		return log
+	}
+
+	// The list is only appended to or cleared, never modified in place, so the
+	// slice may be used unlocked
+	contextExtractors.RLock()
+	list := contextExtractors.list
+	contextExtractors.RUnlock()
+
+	var extracted Fields
+	for _, ext := range list {
+		extracted = append(extracted, ext(ctx)...)
+	}
+	if len(extracted) == 0 {
+		return log
+	}
+
+	fields := make(Fields, 0, len(log.fields)+len(extracted))
+	fields = append(fields, log.fields...)
+	fields = append(fields, extracted...)
+	log.fields = fields
+	return log
+}
+
+// LogCtx sends a log message with manual Level, source, and message, attaching
+// any fields extracted from ctx.
+func (log Logger) LogCtx(ctx context.Context, lvl Level, source, message string) {
+	if log.skip(lvl) {
+		return
+	}
+	log.withContext(ctx).Log(lvl, source, message)
+}
+
+// LogfCtx logs a formatted log message at the given log level, using the caller
+// as its source and attaching any fields extracted from ctx.
+func (log Logger) LogfCtx(ctx context.Context, lvl Level, format string, args ...interface{}) {
+	if log.skip(lvl) {
+		return
+	}
+	log.withContext(ctx).intLogf(lvl, format, args...)
+}
+
+// FinestCtx is like Finest, but attaches any fields extracted from ctx.
+func (log Logger) FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = FINEST
+	)
+	if log.skip(lvl) {
+		return
+	}
+	log = log.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// FineCtx is like Fine, but attaches any fields extracted from ctx.
+func (log Logger) FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = FINE
+	)
+	if log.skip(lvl) {
+		return
+	}
+	log = log.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// DebugCtx is like Debug, but attaches any fields extracted from ctx.
+func (log Logger) DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = DEBUG
+	)
+	if log.skip(lvl) {
+		return
+	}
+	log = log.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// TraceCtx is like Trace, but attaches any fields extracted from ctx.
+func (log Logger) TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = TRACE
+	)
+	if log.skip(lvl) {
+		return
+	}
+	log = log.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// InfoCtx is like Info, but attaches any fields extracted from ctx.
+func (log Logger) InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = INFO
+	)
+	if log.skip(lvl) {
+		return
+	}
+	log = log.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// WarnCtx is like Warn, but attaches any fields extracted from ctx.
+func (log Logger) WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = WARNING
+	)
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	if !log.skip(lvl) {
+		log.withContext(ctx).intLogf(lvl, "%s", msg)
+	}
+	return errors.New(msg)
+}
+
+// ErrorCtx is like Error, but attaches any fields extracted from ctx.
+func (log Logger) ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = ERROR
+	)
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	if !log.skip(lvl) {
+		log.withContext(ctx).intLogf(lvl, "%s", msg)
+	}
+	return errors.New(msg)
+}
+
+// CriticalCtx is like Critical, but attaches any fields extracted from ctx.
+func (log Logger) CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = CRITICAL
+	)
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	if !log.skip(lvl) {
+		log.withContext(ctx).intLogf(lvl, "%s", msg)
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A DedupLogWriter collapses consecutive records with the same Level, Source
+// and Message written to another LogWriter, like syslogd does.  The first
+// record of a run is written as usual, and the rest are counted and reported
+// with a single "last message repeated N times" record when a different record
+// is written, when the timeout has elapsed since the first repeat, or when the
+// writer is closed.
+type DedupLogWriter struct {
+	LogWriter
+
+	timeout time.Duration
+
+	lock    sync.Mutex
+	last    *LogRecord
+	repeats int
+	timer   *time.Timer
+
+	// Incremented each time repeats are reported, so that the timer of an
+	// earlier run does not report the repeats of a later one
+	run uint64
+}
+
+// NewDedupLogWriter returns a DedupLogWriter which writes to w, reporting
+// repeated records at least once per timeout.
+func NewDedupLogWriter(w LogWriter, timeout time.Duration) *DedupLogWriter {
+	return &DedupLogWriter{
+		LogWriter: w,
+		timeout:   timeout,
+	}
+}
+
+// This is the DedupLogWriter's output method
+func (w *DedupLogWriter) LogWrite(rec *LogRecord) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if last := w.last; last != nil && last.Level == rec.Level && last.Source == rec.Source && last.Message == rec.Message {
+		if w.releases() {
+			rec.release()
+		}
+		w.repeats++
+		if w.repeats == 1 && w.timeout > 0 {
+			run := w.run
+			w.timer = time.AfterFunc(w.timeout, func() {
+				w.lock.Lock()
+				defer w.lock.Unlock()
+				if w.run == run {
+					w.report(time.Now())
+				}
+			})
+		}
+		return
+	}
+
+	w.report(rec.Created)
+	w.keep(rec)
+	w.LogWriter.LogWrite(rec)
+}
+
+// Keep a reference to the record to compare later records with, releasing the
+// previous one.  Must be called with the lock held.
+func (w *DedupLogWriter) keep(rec *LogRecord) {
+	if !w.releases() {
+		w.last = rec
+		return
+	}
+	if w.last != nil {
+		w.last.release()
+	}
+	if rec != nil {
+		rec.retain()
+	}
+	w.last = rec
+}
+
+// Flush reports any repeated records, and then flushes the wrapped LogWriter.
+func (w *DedupLogWriter) Flush() {
+	w.lock.Lock()
+	w.report(time.Now())
+	w.lock.Unlock()
+
+	w.LogWriter.Flush()
+}
+
+// Close reports any repeated records, and then closes the wrapped LogWriter.
+func (w *DedupLogWriter) Close() {
+	w.lock.Lock()
+	w.report(time.Now())
+	w.keep(nil)
+	w.lock.Unlock()
+
+	w.LogWriter.Close()
+}
+
+// Returns the wrapped LogWriter
+func (w *DedupLogWriter) unwrap() LogWriter {
+	return w.LogWriter
+}
+
+// Repeated records are released, and the rest are released by the wrapped
+// LogWriter if it releases records
+func (w *DedupLogWriter) releases() bool {
+	return releases(w.LogWriter)
+}
+
+// Write a record reporting the number of times the last record was repeated, if
+// it has been.  Must be called with the lock held.
+func (w *DedupLogWriter) report(now time.Time) {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.run++
+	if w.repeats == 0 {
+		return
+	}
+
+	w.LogWriter.LogWrite(&LogRecord{
+		Level:   w.last.Level,
+		Created: now,
+		Source:  w.last.Source,
+		Message: fmt.Sprintf("last message repeated %d times", w.repeats),
+	})
+	w.repeats = 0
+}
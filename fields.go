@@ -0,0 +1,117 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Field is a single key/value pair attached to a LogRecord.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Fields is an ordered collection of key/value pairs.  Fields are rendered in
+// the order in which they were added.
+type Fields []Field
+
+// Build a Fields collection from alternating keys and values.  Keys that are
+// not strings are formatted with fmt.Sprint, and a trailing key without a value
+// is given a nil value.
+func fieldsFromKeyvals(keyvals []interface{}) Fields {
+	fields := make(Fields, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		var key string
+		switch k := keyvals[i].(type) {
+		case string:
+			key = k
+		default:
+			key = fmt.Sprint(k)
+		}
+		var value interface{}
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fields = append(fields, Field{key, value})
+	}
+	return fields
+}
+
+// String renders the fields as space-separated key=value pairs.  Values which
+// are empty or contain spaces, quotes or equals signs are quoted.
+func (f Fields) String() string {
+	out := bytes.NewBuffer(make([]byte, 0, 16*len(f)))
+	f.writeText(out)
+	return out.String()
+}
+
+func (f Fields) writeText(out *bytes.Buffer) {
+	for i, field := range f {
+		if i > 0 {
+			out.WriteByte(' ')
+		}
+		out.WriteString(field.Key)
+		out.WriteByte('=')
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+			value = strconv.Quote(value)
+		}
+		out.WriteString(value)
+	}
+}
+
+// Render the fields as XML elements, one <field> per line, indented to match
+// the records written by NewXMLLogWriter.
+func (f Fields) writeXML(out *bytes.Buffer) {
+	for _, field := range f {
+		out.WriteString("\n\t\t<field name=\"")
+		xml.EscapeText(out, []byte(field.Key))
+		out.WriteString("\">")
+		xml.EscapeText(out, []byte(fmt.Sprint(field.Value)))
+		out.WriteString("</field>")
+	}
+}
+
+// MarshalJSON encodes the fields as a JSON object, preserving their order.
+// Values which cannot be encoded as JSON are encoded as strings instead.
+func (f Fields) MarshalJSON() ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, 16*len(f)+2))
+	out.WriteByte('{')
+	for i, field := range f {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		key, err := json.Marshal(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteByte(':')
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(field.Value))
+		}
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+// With returns a Logger which shares the Filters of log, but attaches the
+// given key/value pairs to every record it writes, after any fields already
+// attached to log.  The arguments alternate between keys and values, e.g.
+//
+//	reqlog := log.With("request", id, "user", name)
+func (log Logger) With(keyvals ...interface{}) Logger {
+	fields := make(Fields, 0, len(log.fields)+(len(keyvals)+1)/2)
+	fields = append(fields, log.fields...)
+	fields = append(fields, fieldsFromKeyvals(keyvals)...)
+	log.fields = fields
+	return log
+}
@@ -12,6 +12,7 @@ import (
 	"regexp"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -61,7 +62,7 @@ func makeDirectory(filename string) error {
 
 // This log writer sends output to a file
 type FileLogWriter struct {
-	rec             chan *LogRecord
+	queue           *recordQueue
 	rot             chan bool
 	completed       chan int
 	backgroundTasks chan string
@@ -75,7 +76,7 @@ type FileLogWriter struct {
 	errorWriter io.Writer
 
 	// The logging format
-	format string
+	format Formatter
 
 	// File header/trailer
 	header, trailer string
@@ -114,24 +115,38 @@ type FileLogWriter struct {
 	rotationFailures uint64
 	writeFailures    uint64
 
+	// Failures since the writer was created (accessed atomically)
+	totalRotationFailures uint64
+	totalWriteFailures    uint64
+
 	// Whether we've fully started, that is, received our first log message
 	started bool
 }
 
-// This is the FileLogWriter's output method
+// This is the FileLogWriter's output method.  It blocks while the buffer of
+// records waiting for the file is full, unless an OverflowPolicy has been set.
 func (w *FileLogWriter) LogWrite(rec *LogRecord) {
-	w.rec <- rec
+	w.queue.put(rec)
 }
 
 func (w *FileLogWriter) Close() {
-	close(w.rec)
+	close(w.queue.records)
 	<-w.completed
 	close(w.backgroundTasks)
 	w.wg.Wait()
 }
 
+// Flush blocks until every record logged before it has been written to the
+// file.  It does not wait for background compression of rotated files.
+func (w *FileLogWriter) Flush() {
+	w.queue.flush()
+}
+
 // Track write failures and prints to stderr when possible. If err is nil, we'll try to clear the failures
 func (w *FileLogWriter) handleWriteFailure(err error) {
+	if err != nil {
+		atomic.AddUint64(&w.totalWriteFailures, 1)
+	}
 	// Try to note any previous failures
 	if w.writeFailures != 0 {
 		_, fprintfErr := fmt.Fprintf(w.errorWriter, "FileLogWriter(%q): Dropped %d previous log message(s)\n", w.filename, w.writeFailures)
@@ -156,6 +171,9 @@ func (w *FileLogWriter) handleWriteFailure(err error) {
 
 // Track rotation failures and prints to stderr when possible. If err is nil, we'll try to clear the failures
 func (w *FileLogWriter) handleRotationFailure(err error) {
+	if err != nil {
+		atomic.AddUint64(&w.totalRotationFailures, 1)
+	}
 	// Try to note any previous failures
 	if w.rotationFailures != 0 {
 		_, fprintfErr := fmt.Fprintf(w.errorWriter, "FileLogWriter(%q): %d previous rotation failures occurred\n", w.filename, w.rotationFailures)
@@ -178,6 +196,32 @@ func (w *FileLogWriter) handleRotationFailure(err error) {
 	}
 }
 
+// Write a record to the file, rotating it first if necessary.  Only called by
+// the writer goroutine.
+func (w *FileLogWriter) write(rec *LogRecord) {
+	now := time.Now()
+	if (w.maxlines > 0 && w.maxlines_curlines >= w.maxlines) ||
+		(w.maxsize > 0 && w.maxsize_cursize >= w.maxsize) {
+		err := w.handleRotate(now)
+		w.handleRotationFailure(err)
+	} else if w.daily && now.Day() != w.daily_opendate {
+		// Since we crossed the time boundary, back the date up by one day
+		err := w.handleRotate(now.Add(-1 * 24 * time.Hour))
+		w.handleRotationFailure(err)
+	}
+
+	// Perform the write
+	out := getBuffer()
+	w.format.FormatRecord(out, rec)
+	n, err := w.file.Write(out.Bytes())
+	putBuffer(out)
+	w.handleWriteFailure(err)
+
+	// Update the counts
+	w.maxlines_curlines++
+	w.maxsize_cursize += n
+}
+
 // This is called on first log write
 func (w *FileLogWriter) handleStartupRotation() error {
 	// Skip rotation if the current file didn't exist at startup
@@ -209,12 +253,12 @@ func (w *FileLogWriter) handleStartupRotation() error {
 //   [%D %T] [%L] (%S) %M
 func NewFileLogWriter(fname string, rotate bool, compress bool) *FileLogWriter {
 	w := &FileLogWriter{
-		rec:                         make(chan *LogRecord, LogBufferLength),
+		queue:                       newRecordQueue(),
 		rot:                         make(chan bool),
 		backgroundTasks:             make(chan string, 1),
 		completed:                   make(chan int),
 		filename:                    fname,
-		format:                      "[%D %T] [%L] (%S) %M",
+		format:                      CompileFormat(FORMAT_DEFAULT),
 		rotate:                      rotate,
 		rotateDateSuffix:            false,
 		rotateOnStartup:             true,
@@ -268,29 +312,11 @@ func NewFileLogWriter(fname string, rotate bool, compress bool) *FileLogWriter {
 			case <-w.rot:
 				err := w.handleRotate(time.Now())
 				w.handleRotationFailure(err)
-			case rec, ok := <-w.rec:
-				if !ok {
+			case rec, ok := <-w.queue.records:
+				if !w.queue.receive(rec, ok, w.write) {
 					close(w.completed)
 					return
 				}
-				now := time.Now()
-				if (w.maxlines > 0 && w.maxlines_curlines >= w.maxlines) ||
-					(w.maxsize > 0 && w.maxsize_cursize >= w.maxsize) {
-					err := w.handleRotate(now)
-					w.handleRotationFailure(err)
-				} else if w.daily && now.Day() != w.daily_opendate {
-					// Since we crossed the time boundary, back the date up by one day
-					err := w.handleRotate(now.Add(-1 * 24 * time.Hour))
-					w.handleRotationFailure(err)
-				}
-
-				// Perform the write
-				n, err := fmt.Fprint(w.file, FormatLogRecord(w.format, rec))
-				w.handleWriteFailure(err)
-
-				// Update the counts
-				w.maxlines_curlines++
-				w.maxsize_cursize += n
 			}
 		}
 	}()
@@ -598,7 +624,14 @@ func (w *FileLogWriter) openLogFile() error {
 // Set the logging format (chainable).  Must be called before the first log
 // message is written.
 func (w *FileLogWriter) SetFormat(format string) *FileLogWriter {
-	w.format = format
+	w.format = CompileFormat(format)
+	return w
+}
+
+// Set a Formatter, such as a JSONFormatter, to use in place of a format string
+// (chainable).  Must be called before the first log message is written.
+func (w *FileLogWriter) SetFormatter(f Formatter) *FileLogWriter {
+	w.format = f
 	return w
 }
 
@@ -677,6 +710,41 @@ func (w *FileLogWriter) SetCompressionMethod(compressionMethod CompressionMethod
 	return w
 }
 
+// SetOverflowPolicy decides what happens to records logged while writing to the
+// file (or rotating it) is falling behind (chainable).  The timeout is only
+// used by OVERFLOW_TIMEOUT.
+func (w *FileLogWriter) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) *FileLogWriter {
+	w.queue.setOverflowPolicy(policy, timeout)
+	return w
+}
+
+// Dropped returns the number of records which never reached the file because
+// the buffer in front of it was full.
+func (w *FileLogWriter) Dropped() uint64 {
+	return w.queue.droppedRecords()
+}
+
+// WriteFailures returns the number of records which could not be written to
+// the file.
+func (w *FileLogWriter) WriteFailures() uint64 {
+	return atomic.LoadUint64(&w.totalWriteFailures)
+}
+
+// RotationFailures returns the number of times the file could not be rotated.
+func (w *FileLogWriter) RotationFailures() uint64 {
+	return atomic.LoadUint64(&w.totalRotationFailures)
+}
+
+// Returns the number of records not yet written to the file
+func (w *FileLogWriter) queued() int {
+	return len(w.queue.records)
+}
+
+// Records are released once they have been written to the file
+func (w *FileLogWriter) releases() bool {
+	return true
+}
+
 // NewXMLLogWriter is a utility method for creating a FileLogWriter set up to
 // output XML record log messages instead of line-based ones.
 func NewXMLLogWriter(fname string, rotate bool) *FileLogWriter {
@@ -684,6 +752,6 @@ func NewXMLLogWriter(fname string, rotate bool) *FileLogWriter {
 		`	<record level="%L">
 		<timestamp>%D %T</timestamp>
 		<source>%S</source>
-		<message>%M</message>
+		<message>%M</message>%X
 	</record>`).SetHeadFoot("<log created=\"%D %T\">", "</log>")
 }
@@ -0,0 +1,95 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"sync"
+)
+
+// A Hook transforms a record before it is written to any Filter.  It may
+// modify the record in place or return a different one, and returns nil to
+// drop the record.  Hooks are called from the logging goroutine, and must not
+// keep the record or modify the slices it refers to (such as its Fields) in
+// place.
+type Hook func(rec *LogRecord) *LogRecord
+
+var namedHooks struct {
+	sync.RWMutex
+	hooks map[string]Hook
+}
+
+func init() {
+	RegisterHook("hostname", func(rec *LogRecord) *LogRecord {
+		fields := make(Fields, 0, len(rec.Fields)+1)
+		fields = append(fields, rec.Fields...)
+		rec.Fields = append(fields, Field{"host", hostname})
+		return rec
+	})
+}
+
+// RegisterHook names a Hook so that it can be added to loggers by the XML
+// configuration with <hook>name</hook>, replacing any hook registered with the
+// same name.  The "hostname" hook, which adds a "host" field to every record,
+// is registered by default.
+func RegisterHook(name string, hook Hook) {
+	namedHooks.Lock()
+	defer namedHooks.Unlock()
+	if namedHooks.hooks == nil {
+		namedHooks.hooks = make(map[string]Hook)
+	}
+	namedHooks.hooks[name] = hook
+}
+
+// Returns the hook registered with the given name, if any
+func lookupHook(name string) (Hook, bool) {
+	namedHooks.RLock()
+	defer namedHooks.RUnlock()
+	hook, ok := namedHooks.hooks[name]
+	return hook, ok
+}
+
+// AddHook adds a Hook which is run for every record logged to the Logger, or to
+// a Logger below it in the hierarchy, before it is written to any Filter.  The
+// hooks of a Logger run in the order in which they were added, before those of
+// its ancestors.  This is safe to call while other goroutines are logging.
+// Returns the logger for chaining.
+func (log Logger) AddHook(hook Hook) Logger {
+	log.updateHooks(func(hooks []Hook) []Hook {
+		return append(hooks, hook)
+	})
+	return log
+}
+
+// ClearHooks removes every Hook added to the Logger, but not those of its
+// ancestors.
+func (log Logger) ClearHooks() {
+	log.updateHooks(func([]Hook) []Hook {
+		return nil
+	})
+}
+
+// Run the hooks of the category and its ancestors, returning nil if the record
+// was dropped
+func (c *category) runHooks(rec *LogRecord) *LogRecord {
+	for ; c != nil && rec != nil; c = c.parent {
+		hooks, _ := c.hooks.Load().([]Hook)
+		for _, hook := range hooks {
+			if rec = hook(rec); rec == nil {
+				break
+			}
+		}
+	}
+	return rec
+}
+
+// Atomically replace the hooks with the result of calling update on a copy of
+// the current ones
+func (c *category) updateHooks(update func(hooks []Hook) []Hook) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	old, _ := c.hooks.Load().([]Hook)
+	hooks := make([]Hook, len(old), len(old)+1)
+	copy(hooks, old)
+	c.hooks.Store(update(hooks))
+}
@@ -0,0 +1,186 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// The layout of JSONFormatter timestamps: RFC 3339 with nanoseconds
+const jsonTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// A JSONFormatter renders each record as a JSON object on a line of its own,
+// for log shippers.  The object has the record's time, level name, source,
+// message and stack trace under the configured keys, followed by its Fields.
+// Entries whose key is empty are left out, as are an empty source and stack.
+// For example:
+//
+//	{"time":"2006-01-02T15:04:05.000000000-07:00","level":"INFO","source":"main.main:12","message":"started","port":8080}
+//
+// Field values are encoded with encoding/json, except that errors are encoded
+// as their message, and values which cannot be encoded are encoded as strings.
+type JSONFormatter struct {
+	TimeKey    string
+	LevelKey   string
+	SourceKey  string
+	MessageKey string
+	StackKey   string
+}
+
+// NewJSONFormatter returns a JSONFormatter which uses the keys "time", "level",
+// "source", "message" and "stack".
+func NewJSONFormatter() *JSONFormatter {
+	return &JSONFormatter{
+		TimeKey:    "time",
+		LevelKey:   "level",
+		SourceKey:  "source",
+		MessageKey: "message",
+		StackKey:   "stack",
+	}
+}
+
+// FormatRecord appends the record as a line of JSON to out.
+func (f *JSONFormatter) FormatRecord(out *bytes.Buffer, rec *LogRecord) {
+	var scratch [64]byte
+
+	out.WriteByte('{')
+	first := true
+	key := func(key string) {
+		if !first {
+			out.WriteByte(',')
+		}
+		first = false
+		writeJSONString(out, key)
+		out.WriteByte(':')
+	}
+
+	if len(f.TimeKey) > 0 {
+		key(f.TimeKey)
+		out.WriteByte('"')
+		out.Write(rec.Created.AppendFormat(scratch[:0], jsonTimeLayout))
+		out.WriteByte('"')
+	}
+	if len(f.LevelKey) > 0 {
+		key(f.LevelKey)
+		writeJSONString(out, rec.Level.Name())
+	}
+	if len(f.SourceKey) > 0 && len(rec.Source) > 0 {
+		key(f.SourceKey)
+		writeJSONString(out, rec.Source)
+	}
+	if len(f.MessageKey) > 0 {
+		key(f.MessageKey)
+		writeJSONString(out, rec.Message)
+	}
+	if len(f.StackKey) > 0 && len(rec.Stack) > 0 {
+		key(f.StackKey)
+		writeJSONString(out, rec.Stack)
+	}
+	for _, field := range rec.Fields {
+		key(field.Key)
+		writeJSONValue(out, field.Value, scratch[:0])
+	}
+	out.WriteString("}\n")
+}
+
+// Format returns the record as a line of JSON.
+func (f *JSONFormatter) Format(rec *LogRecord) string {
+	out := getBuffer()
+	defer putBuffer(out)
+	f.FormatRecord(out, rec)
+	return out.String()
+}
+
+// Write a field value as JSON, using scratch for numbers
+func writeJSONValue(out *bytes.Buffer, value interface{}, scratch []byte) {
+	switch v := value.(type) {
+	case nil:
+		out.WriteString("null")
+	case string:
+		writeJSONString(out, v)
+	case bool:
+		out.Write(strconv.AppendBool(scratch, v))
+	case int:
+		out.Write(strconv.AppendInt(scratch, int64(v), 10))
+	case int32:
+		out.Write(strconv.AppendInt(scratch, int64(v), 10))
+	case int64:
+		out.Write(strconv.AppendInt(scratch, v, 10))
+	case uint:
+		out.Write(strconv.AppendUint(scratch, uint64(v), 10))
+	case uint32:
+		out.Write(strconv.AppendUint(scratch, uint64(v), 10))
+	case uint64:
+		out.Write(strconv.AppendUint(scratch, v, 10))
+	case error:
+		writeJSONString(out, v.Error())
+	default:
+		js, err := json.Marshal(v)
+		if err != nil {
+			writeJSONString(out, fmt.Sprint(v))
+			return
+		}
+		out.Write(js)
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+// Write s as a JSON string, replacing invalid UTF-8 with U+FFFD
+func writeJSONString(out *bytes.Buffer, s string) {
+	out.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				out.WriteString(s[start:i])
+				out.WriteString("\ufffd")
+				i += size
+				start = i
+				continue
+			}
+			i += size
+			continue
+		}
+		if c >= 0x20 && c != '"' && c != '\\' {
+			i++
+			continue
+		}
+		out.WriteString(s[start:i])
+		switch c {
+		case '"', '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			out.WriteString(`\u00`)
+			out.WriteByte(hexDigits[c>>4])
+			out.WriteByte(hexDigits[c&0xF])
+		}
+		i++
+		start = i
+	}
+	out.WriteString(s[start:])
+	out.WriteByte('"')
+}
+
+// NewJSONLogWriter is a utility method for creating a FileLogWriter set up to
+// output a line of JSON for each record (see JSONFormatter).
+func NewJSONLogWriter(fname string, rotate bool) *FileLogWriter {
+	w := NewFileLogWriter(fname, rotate, false)
+	if w == nil {
+		return nil
+	}
+	return w.SetFormatter(NewJSONFormatter())
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The names of a registered level
+type levelNames struct {
+	name  string // e.g. WARNING, used by ParseLevel and MarshalText
+	short string // e.g. WARN, used by String and the %L format code
+}
+
+// The registered levels.  The registry is replaced rather than modified, so it
+// can be read without locking while records are formatted.
+type levelRegistry struct {
+	byLevel map[Level]levelNames
+	byName  map[string]Level
+}
+
+var (
+	levels    atomic.Value // *levelRegistry
+	levelLock sync.Mutex   // Guards replacement of the registry
+)
+
+func init() {
+	levels.Store(&levelRegistry{
+		byLevel: map[Level]levelNames{},
+		byName:  map[string]Level{},
+	})
+	for _, l := range []struct {
+		lvl         Level
+		name, short string
+	}{
+		{FINEST, "FINEST", "FNST"},
+		{FINE, "FINE", "FINE"},
+		{TRACE, "TRACE", "TRAC"},
+		{DEBUG, "DEBUG", "DEBG"},
+		{INFO, "INFO", "INFO"},
+		{WARNING, "WARNING", "WARN"},
+		{ERROR, "ERROR", "EROR"},
+		{CRITICAL, "CRITICAL", "CRIT"},
+	} {
+		if err := RegisterLevel(l.lvl, l.name, l.short); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func loadLevels() *levelRegistry {
+	return levels.Load().(*levelRegistry)
+}
+
+// RegisterLevel defines a level with the given full and short names (at most
+// four characters by convention, e.g. "NOTE" for "NOTICE"), which are
+// understood by ParseLevel, the %L format code and the XML configuration.
+// Names are not case sensitive.  Levels are ordered by value, so a level which
+// should be more severe than CRITICAL could be registered with e.g.
+//
+//	const AUDIT = log4go.CRITICAL + 1
+//	log4go.RegisterLevel(AUDIT, "AUDIT", "AUDT")
+//
+// Registering a level again replaces its names.  An error is returned if either
+// name is empty or already used by another level.
+func RegisterLevel(lvl Level, name, short string) error {
+	name, short = strings.ToUpper(strings.TrimSpace(name)), strings.ToUpper(strings.TrimSpace(short))
+	if len(name) == 0 || len(short) == 0 {
+		return fmt.Errorf("RegisterLevel(%d): empty level name", int(lvl))
+	}
+
+	levelLock.Lock()
+	defer levelLock.Unlock()
+
+	old := loadLevels()
+	for _, n := range []string{name, short} {
+		if other, ok := old.byName[n]; ok && other != lvl {
+			return fmt.Errorf("RegisterLevel(%d): name %q already used by level %d", int(lvl), n, int(other))
+		}
+	}
+
+	reg := &levelRegistry{
+		byLevel: make(map[Level]levelNames, len(old.byLevel)+1),
+		byName:  make(map[string]Level, len(old.byName)+2),
+	}
+	for l, names := range old.byLevel {
+		if l != lvl {
+			reg.byLevel[l] = names
+			reg.byName[names.name] = l
+			reg.byName[names.short] = l
+		}
+	}
+	reg.byLevel[lvl] = levelNames{name, short}
+	reg.byName[name] = lvl
+	reg.byName[short] = lvl
+	levels.Store(reg)
+	return nil
+}
+
+// ParseLevel returns the level with the given full or short name, e.g. "warn",
+// "WARN" or "Warning".  The decimal value of a level is also accepted.
+func ParseLevel(name string) (Level, error) {
+	name = strings.TrimSpace(name)
+	if lvl, ok := loadLevels().byName[strings.ToUpper(name)]; ok {
+		return lvl, nil
+	}
+	if n, err := strconv.ParseInt(name, 10, 32); err == nil {
+		return Level(n), nil
+	}
+	return FINEST, fmt.Errorf("ParseLevel: unknown level %q", name)
+}
+
+// String returns the short name of the level, e.g. "WARN", or "UNKNOWN" if the
+// level has not been registered.
+func (l Level) String() string {
+	if names, ok := loadLevels().byLevel[l]; ok {
+		return names.short
+	}
+	return "UNKNOWN"
+}
+
+// Name returns the full name of the level, e.g. "WARNING", or its decimal value
+// if the level has not been registered.
+func (l Level) Name() string {
+	if names, ok := loadLevels().byLevel[l]; ok {
+		return names.name
+	}
+	return strconv.Itoa(int(l))
+}
+
+// MarshalText encodes the level as its full name.  This means that levels are
+// encoded by name in JSON, e.g. by the SocketLogWriter, where versions before
+// 4.0 encoded them as numbers (see UnmarshalJSON).
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.Name()), nil
+}
+
+// UnmarshalText decodes a level name as ParseLevel does.
+func (l *Level) UnmarshalText(text []byte) error {
+	lvl, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = lvl
+	return nil
+}
+
+// UnmarshalJSON decodes a level from a JSON string holding its name, or from a
+// JSON number, so that records encoded by versions before 4.0 can still be
+// decoded.
+func (l *Level) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var name string
+		if err := json.Unmarshal(data, &name); err != nil {
+			return err
+		}
+		return l.UnmarshalText([]byte(name))
+	}
+	n, err := strconv.ParseInt(string(data), 10, 32)
+	if err != nil {
+		return fmt.Errorf("Level.UnmarshalJSON: invalid level %s", data)
+	}
+	*l = Level(n)
+	return nil
+}
+
+// Set implements flag.Value, so that a level can be given on the command line:
+//
+//	lvl := log4go.INFO
+//	flag.Var(&lvl, "level", "minimum level to log")
+func (l *Level) Set(name string) error {
+	return l.UnmarshalText([]byte(name))
+}
@@ -28,18 +28,45 @@
 //   output, but the FileLogWriter does.
 // - The utility functions (Info, Debug, Warn, etc) derive their source from the
 //   calling function, and this incurs extra overhead.
+// - Loggers returned by With attach key/value Fields to every record they write.
+//   The FileLogWriter renders them with the %F format code.
+// - Named loggers returned by GetLogger (e.g. "db.pool") write to their own
+//   filters and to those of their ancestors ("db", then the root), and inherit
+//   any level set on an ancestor with SetLoggerLevel.
+//
+// Changes from 3.0:
+// - Logger is no longer a map but a struct, so that its filters can be changed
+//   while other goroutines are logging.  Create one with NewLogger or
+//   NewDefaultLogger rather than make(Logger) or a composite literal, and use
+//   AddFilter, SetFilter, RemoveFilter, Filter and Filters instead of indexing
+//   it or ranging over it.  NewLogger is no longer deprecated.
+// - Filter no longer has an exported Level field, because its level may be
+//   changed while records are being logged.  Create one with NewFilter rather
+//   than a composite literal such as &Filter{lvl, writer}, and use its GetLevel
+//   and SetLevel methods (or Logger.SetLevel) instead of the field.
+// - SocketLogWriter and FormatLogWriter are no longer channel types but
+//   structs, and NewSocketLogWriter and NewFormatLogWriter return pointers to
+//   them.  Declare variables as *SocketLogWriter or *FormatLogWriter, and use
+//   their LogWrite and Close methods instead of sending records on them or
+//   closing them.
+// - Levels are encoded in JSON by name (e.g. "WARNING") rather than number, so
+//   the records sent by the SocketLogWriter have changed.  Both forms are
+//   decoded.
+// - The LogWriter interface has a Flush method.  A LogWriter of your own must
+//   add one: an empty Flush will do if it writes records before LogWrite
+//   returns, and otherwise Flush should wait until the records passed to
+//   LogWrite so far have been written.
 //
 // Changes from 2.0:
 // - The external interface has remained mostly stable, but a lot of the
 //   internals have been changed, so if you depended on any of this or created
 //   your own LogWriter, then you will probably have to update your code.  In
-//   particular, Logger is now a map and ConsoleLogWriter is now a channel
-//   behind-the-scenes, and the LogWrite method no longer has return values.
+//   particular, ConsoleLogWriter is now a channel behind-the-scenes, and the
+//   LogWrite method no longer has return values.
 //
 // Future work: (please let me know if you think I should work on any of these particularly)
 // - Log file rotation
 // - Logging configuration files ala log4j
-// - Have the ability to remove filters?
 // - Have GetInfoChannel, GetDebugChannel, etc return a chan string that allows
 //   for another method of logging
 // - Add an XML filter type
@@ -48,23 +75,26 @@ package log4go
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
-	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Version information
 const (
-	L4G_VERSION = "log4go-v3.0.1"
-	L4G_MAJOR   = 3
+	L4G_VERSION = "log4go-v4.0.0"
+	L4G_MAJOR   = 4
 	L4G_MINOR   = 0
-	L4G_BUILD   = 1
+	L4G_BUILD   = 0
 )
 
 /****** Constants ******/
 
-// These are the integer logging levels used by the logger
+// These are the integer logging levels used by the logger.  Further levels can
+// be defined with RegisterLevel.
 type Level int
 
 const (
@@ -78,18 +108,6 @@ const (
 	CRITICAL
 )
 
-// Logging level strings
-var (
-	levelStrings = [...]string{"FNST", "FINE", "TRAC", "DEBG", "INFO", "WARN", "EROR", "CRIT"}
-)
-
-func (l Level) String() string {
-	if l < 0 || int(l) > len(levelStrings) {
-		return "UNKNOWN"
-	}
-	return levelStrings[int(l)]
-}
-
 /****** Variables ******/
 var (
 	// LogBufferLength specifies how many log messages a particular log4go
@@ -105,15 +123,40 @@ type LogRecord struct {
 	Created time.Time // The time at which the log message was created (nanoseconds)
 	Source  string    // The message source
 	Message string    // The log message
+	Fields  Fields    `json:",omitempty"` // Structured key/value data
+	Stack   string    `json:",omitempty"` // The stack trace of the caller, if captured
+
+	// The program counter of the caller, if it was looked up
+	pc uintptr
+
+	// The sequence number of the record, and the ID of the goroutine which
+	// logged it if a format needs it (see %R and %G)
+	seq       uint64
+	goroutine uint64
+
+	// Closed by a LogWriter's goroutine when it reaches this record, which
+	// is only queued by Flush and is never written
+	flushed chan struct{}
+
+	// References held to a record taken from the pool, and whether it may be
+	// returned to the pool once they are released (accessed atomically)
+	refs    int32
+	recycle int32
 }
 
 /****** LogWriter ******/
 
 // This is an interface for anything that should be able to write logs
 type LogWriter interface {
-	// This will be called to log a LogRecord message.
+	// This will be called to log a LogRecord message.  The record must not be
+	// modified, but may be kept: the records the package reuses are never
+	// given to LogWriters from outside of it.
 	LogWrite(rec *LogRecord)
 
+	// This should block until every record passed to LogWrite before it was
+	// called has been written, without closing the LogWriter.
+	Flush()
+
 	// This should clean up anything lingering about the LogWriter, as it is called before
 	// the LogWriter is removed.  LogWrite should not be called after Close.
 	Close()
@@ -122,22 +165,153 @@ type LogWriter interface {
 /****** Logger ******/
 
 // A Filter represents the log level below which no log records are written to
-// the associated LogWriter.
+// the associated LogWriter.  A Filter may also have a maximum level above which
+// no records are written, and Predicates which every record must satisfy.  The
+// levels and predicates may be changed while records are being logged.  A
+// Filter with only its LogWriter set writes records of every level.
 type Filter struct {
-	Level Level
+	level int32 // accessed atomically
+
+	// The maximum level, stored as math.MaxInt32 minus the level (wrapping
+	// around), so that the zero value means no maximum (accessed atomically)
+	maxLevel int32
+
+	// Number of records passed to the LogWriter (accessed atomically)
+	written uint64
+
+	// The current []Predicate, replaced rather than modified
+	predicates atomic.Value
+	lock       sync.Mutex
+
+	// Held for reading while a record is passed to the LogWriter, and for
+	// writing while the LogWriter is closed
+	writing sync.RWMutex
+	closed  bool
+
 	LogWriter
 }
 
+// Create a new Filter which writes records at lvl or higher to writer.
+func NewFilter(lvl Level, writer LogWriter) *Filter {
+	return &Filter{
+		level:     int32(lvl),
+		LogWriter: writer,
+	}
+}
+
+// GetLevel returns the level below which records are not written.
+func (f *Filter) GetLevel() Level {
+	return Level(atomic.LoadInt32(&f.level))
+}
+
+// SetLevel changes the level below which records are not written.  It is safe
+// to call while other goroutines are logging.
+func (f *Filter) SetLevel(lvl Level) {
+	atomic.StoreInt32(&f.level, int32(lvl))
+}
+
+// GetMaxLevel returns the level above which records are not written.  If no
+// maximum has been set, this is the largest possible Level.
+func (f *Filter) GetMaxLevel() Level {
+	return Level(math.MaxInt32 - atomic.LoadInt32(&f.maxLevel))
+}
+
+// SetMaxLevel changes the level above which records are not written.  It is
+// safe to call while other goroutines are logging.
+func (f *Filter) SetMaxLevel(lvl Level) {
+	atomic.StoreInt32(&f.maxLevel, math.MaxInt32-int32(lvl))
+}
+
+// AddPredicate adds a Predicate which must return true for a record to be
+// written.  Predicates are checked in the order in which they were added.  It
+// is safe to call while other goroutines are logging.
+func (f *Filter) AddPredicate(pred Predicate) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	old, _ := f.predicates.Load().([]Predicate)
+	preds := make([]Predicate, len(old), len(old)+1)
+	copy(preds, old)
+	f.predicates.Store(append(preds, pred))
+}
+
+// Determine whether the filter writes records at lvl, ignoring predicates
+func (f *Filter) enabled(lvl Level) bool {
+	return lvl >= f.GetLevel() && lvl <= f.GetMaxLevel()
+}
+
+// Determine whether the filter writes the given record
+func (f *Filter) accepts(rec *LogRecord) bool {
+	if !f.enabled(rec.Level) {
+		return false
+	}
+	preds, _ := f.predicates.Load().([]Predicate)
+	for _, pred := range preds {
+		if !pred(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// Pass a record to the LogWriter, unless the filter has been closed.  Reports
+// whether the record was written.
+func (f *Filter) write(rec *LogRecord) bool {
+	f.writing.RLock()
+	defer f.writing.RUnlock()
+	if f.closed {
+		return false
+	}
+	f.LogWrite(rec)
+	return true
+}
+
+// Flush flushes the LogWriter, unless the filter has been closed, so that a
+// Filter can be flushed while another goroutine removes it from a Logger.
+func (f *Filter) Flush() {
+	f.writing.RLock()
+	defer f.writing.RUnlock()
+	if !f.closed {
+		f.LogWriter.Flush()
+	}
+}
+
+// Close waits for any records being written to the LogWriter by other
+// goroutines, and then closes it.  Records are no longer written to it once
+// Close has been called, so a Filter which was just removed from a Logger can
+// be closed while other goroutines are logging.
+func (f *Filter) Close() {
+	f.writing.Lock()
+	closed := f.closed
+	f.closed = true
+	f.writing.Unlock()
+	if !closed {
+		f.LogWriter.Close()
+	}
+}
+
 // A Logger represents a collection of Filters through which log messages are
-// written.
-type Logger map[string]*Filter
+// written.  Copies of a Logger, including those returned by With, share the
+// same Filters.  Named Loggers returned by GetLogger also write to the Filters
+// of their ancestors.
+type Logger struct {
+	*category
+	fields Fields
+
+	// How the caller is looked up; see WithCallerSkip and WithSourceFormat
+	callerSkip   int
+	sourceFormat SourceFormat
+
+	// The level at which stack traces are captured; see WithStackLevel
+	stackLevel   Level
+	captureStack bool
+}
 
-// Create a new logger.
-//
-// DEPRECATED: Use make(Logger) instead.
+// Create a new root logger with no filters.
 func NewLogger() Logger {
-	os.Stderr.WriteString("warning: use of deprecated NewLogger\n")
-	return make(Logger)
+	return Logger{
+		category: newCategory("", nil),
+	}
 }
 
 // Create a new logger with a "stdout" filter configured to send log messages at
@@ -146,61 +320,165 @@ func NewLogger() Logger {
 // DEPRECATED: use NewDefaultLogger instead.
 func NewConsoleLogger(lvl Level) Logger {
 	os.Stderr.WriteString("warning: use of deprecated NewConsoleLogger\n")
-	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter()},
-	}
+	return NewDefaultLogger(lvl)
 }
 
 // Create a new logger with a "stdout" filter configured to send log messages at
 // or above lvl to standard output.
 func NewDefaultLogger(lvl Level) Logger {
-	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter()},
-	}
+	return NewLogger().AddFilter("stdout", lvl, NewConsoleLogWriter())
 }
 
 // Closes all log writers in preparation for exiting the program or a
 // reconfiguration of logging.  Calling this is not really imperative, unless
 // you want to guarantee that all log messages are written.  Close removes
-// all filters (and thus all LogWriters) from the logger.
+// all filters (and thus all LogWriters) from the logger and from any named
+// loggers below it.
 func (log Logger) Close() {
 	// Close all open loggers
-	for name, filt := range log {
-		filt.Close()
-		delete(log, name)
+	for _, cat := range log.subtree() {
+		old := cat.updateFilters(func(filters map[string]*Filter) {
+			for name := range filters {
+				delete(filters, name)
+			}
+		})
+		for _, filt := range old {
+			filt.Close()
+		}
+	}
+}
+
+// Flush blocks until every record logged to log or to a Logger below it in the
+// hierarchy before Flush was called has been written by their LogWriters.
+// Unlike Close, the filters remain in place.
+func (log Logger) Flush() {
+	for _, cat := range log.subtree() {
+		for _, filt := range cat.loadFilters() {
+			filt.Flush()
+		}
 	}
 }
 
 // Add a new LogWriter to the Logger which will only log messages at lvl or
-// higher.  This function should not be called from multiple goroutines.
-// Returns the logger for chaining.
+// higher, replacing any filter with the same name.  The LogWriter of a
+// replaced filter is not closed.  This is safe to call while other goroutines
+// are logging.  Returns the logger for chaining.
 func (log Logger) AddFilter(name string, lvl Level, writer LogWriter) Logger {
-	log[name] = &Filter{lvl, writer}
+	return log.SetFilter(name, NewFilter(lvl, writer))
+}
+
+// SetFilter adds a Filter created with NewFilter to the Logger, replacing any
+// filter with the same name.  The LogWriter of a replaced filter is not closed.
+// This is safe to call while other goroutines are logging.  Returns the logger
+// for chaining.
+func (log Logger) SetFilter(name string, filt *Filter) Logger {
+	log.updateFilters(func(filters map[string]*Filter) {
+		filters[name] = filt
+	})
 	return log
 }
 
+// Remove the named filter from the Logger and close its LogWriter, once the
+// records already being written to it by other goroutines have been written.
+// Returns false if there was no such filter.
+func (log Logger) RemoveFilter(name string) bool {
+	old := log.updateFilters(func(filters map[string]*Filter) {
+		delete(filters, name)
+	})
+	filt, ok := old[name]
+	if ok {
+		filt.Close()
+	}
+	return ok
+}
+
+// SetLevel changes the level of the named filter of the Logger.  It is safe to
+// call while other goroutines are logging.  Returns false if there was no such
+// filter.
+func (log Logger) SetLevel(name string, lvl Level) bool {
+	filt := log.Filter(name)
+	if filt == nil {
+		return false
+	}
+	filt.SetLevel(lvl)
+	return true
+}
+
+// Filter returns the named filter of the Logger, or nil if there is none.
+func (log Logger) Filter(name string) *Filter {
+	return log.loadFilters()[name]
+}
+
+// Filters returns a copy of the filters of the Logger, keyed by name.  It does
+// not include the filters of any ancestors.
+func (log Logger) Filters() map[string]*Filter {
+	old := log.loadFilters()
+	filters := make(map[string]*Filter, len(old))
+	for name, filt := range old {
+		filters[name] = filt
+	}
+	return filters
+}
+
 /******* Logging *******/
-// Send a formatted log message internally
-func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
-	skip := true
+// Determine whether a message at lvl would be skipped by every filter
+func (log Logger) skip(lvl Level) bool {
+	if min, ok := log.effectiveLevel(); ok && lvl < min {
+		return true
+	}
+	for cat := log.category; cat != nil; cat = cat.parent {
+		for _, filt := range cat.loadFilters() {
+			if filt.enabled(lvl) {
+				return false
+			}
+		}
+	}
+	return true
+}
 
-	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl >= filt.Level {
-			skip = false
-			break
+// Run the hooks of the logger and its ancestors on a record, and then send it
+// to every filter of the logger and its ancestors.  The caller's reference to
+// the record is released once it has been sent.
+func (log Logger) dispatch(rec *LogRecord) {
+	defer rec.release()
+	log.countRecord(rec.Level)
+	rec.seq = atomic.AddUint64(&sequence, 1)
+	if atomic.LoadInt32(&goroutineIDs) != 0 {
+		rec.goroutine = goroutineID()
+	}
+	if rec = log.runHooks(rec); rec == nil {
+		return
+	}
+	for cat := log.category; cat != nil; cat = cat.parent {
+		for _, filt := range cat.loadFilters() {
+			if !filt.accepts(rec) {
+				continue
+			}
+
+			// Each writer gets a reference of its own, and the record is never
+			// reused once it has been given to a writer which may keep it
+			if !releases(filt.LogWriter) {
+				rec.pin()
+			}
+			rec.retain()
+			if !filt.write(rec) {
+				rec.release()
+				continue
+			}
+			atomic.AddUint64(&filt.written, 1)
 		}
 	}
-	if skip {
+}
+
+// Send a formatted log message internally
+func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
+	// Determine if any logging will be done
+	if log.skip(lvl) {
 		return
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-	}
+	pc, src := log.caller()
 
 	msg := format
 	if len(args) > 0 {
@@ -208,91 +486,47 @@ func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
 	}
 
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  src,
-		Message: msg,
-	}
+	rec := pooledRecord()
+	rec.Level, rec.Created, rec.Source, rec.Message = lvl, time.Now(), src, msg
+	rec.Fields, rec.Stack, rec.pc = log.fields, log.stack(lvl, 2), pc
 
 	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
-	}
+	log.dispatch(rec)
 }
 
 // Send a closure log message internally
 func (log Logger) intLogc(lvl Level, closure func() string) {
-	skip := true
-
 	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl >= filt.Level {
-			skip = false
-			break
-		}
-	}
-	if skip {
+	if log.skip(lvl) {
 		return
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-	}
+	pc, src := log.caller()
 
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  src,
-		Message: closure(),
-	}
+	rec := pooledRecord()
+	rec.Level, rec.Created, rec.Source, rec.Message = lvl, time.Now(), src, closure()
+	rec.Fields, rec.Stack, rec.pc = log.fields, log.stack(lvl, 2), pc
 
 	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
-	}
+	log.dispatch(rec)
 }
 
 // Send a log message with manual Level, source, and message.
 func (log Logger) Log(lvl Level, source, message string) {
-	skip := true
-
 	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl >= filt.Level {
-			skip = false
-			break
-		}
-	}
-	if skip {
+	if log.skip(lvl) {
 		return
 	}
 
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  source,
-		Message: message,
-	}
+	rec := pooledRecord()
+	rec.Level, rec.Created, rec.Source, rec.Message = lvl, time.Now(), source, message
+	rec.Fields, rec.Stack = log.fields, log.stack(lvl, 1)
 
 	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
-	}
+	log.dispatch(rec)
 }
 
 // Logf logs a formatted log message at the given log level, using the caller as
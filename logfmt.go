@@ -0,0 +1,275 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A LogfmtFormatter renders each record as a line of logfmt key=value pairs,
+// as read by tools like lnav and Loki.  The line has the record's time, level
+// name, source, message and stack trace under the configured keys, followed by
+// its Fields.  Entries whose key is empty are left out, as are an empty source
+// and stack.  For example:
+//
+//	ts=2006-01-02T15:04:05.000000000-07:00 level=info src=main.main:12 msg="server started" port=8080
+//
+// Values which are empty or contain spaces, equals signs, quotes, control
+// characters or invalid UTF-8 are quoted, with quotes, backslashes and control
+// characters escaped.  Characters in keys which would need quoting are replaced
+// with underscores.  A nil value is written as null.
+type LogfmtFormatter struct {
+	TimeKey    string
+	LevelKey   string
+	SourceKey  string
+	MessageKey string
+	StackKey   string
+}
+
+// NewLogfmtFormatter returns a LogfmtFormatter which uses the keys "ts",
+// "level", "src", "msg" and "stack".
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{
+		TimeKey:    "ts",
+		LevelKey:   "level",
+		SourceKey:  "src",
+		MessageKey: "msg",
+		StackKey:   "stack",
+	}
+}
+
+// FormatRecord appends the record as a line of logfmt to out.
+func (f *LogfmtFormatter) FormatRecord(out *bytes.Buffer, rec *LogRecord) {
+	var scratch [64]byte
+
+	first := true
+	key := func(key string) {
+		if !first {
+			out.WriteByte(' ')
+		}
+		first = false
+		writeLogfmtKey(out, key)
+		out.WriteByte('=')
+	}
+
+	if len(f.TimeKey) > 0 {
+		key(f.TimeKey)
+		out.Write(rec.Created.AppendFormat(scratch[:0], jsonTimeLayout))
+	}
+	if len(f.LevelKey) > 0 {
+		key(f.LevelKey)
+		for _, c := range []byte(rec.Level.Name()) {
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			out.WriteByte(c)
+		}
+	}
+	if len(f.SourceKey) > 0 && len(rec.Source) > 0 {
+		key(f.SourceKey)
+		writeLogfmtValue(out, rec.Source)
+	}
+	if len(f.MessageKey) > 0 {
+		key(f.MessageKey)
+		writeLogfmtValue(out, rec.Message)
+	}
+	if len(f.StackKey) > 0 && len(rec.Stack) > 0 {
+		key(f.StackKey)
+		writeLogfmtValue(out, rec.Stack)
+	}
+	for _, field := range rec.Fields {
+		key(field.Key)
+		switch v := field.Value.(type) {
+		case nil:
+			out.WriteString("null")
+		case string:
+			writeLogfmtValue(out, v)
+		case bool:
+			out.Write(strconv.AppendBool(scratch[:0], v))
+		case int:
+			out.Write(strconv.AppendInt(scratch[:0], int64(v), 10))
+		case int64:
+			out.Write(strconv.AppendInt(scratch[:0], v, 10))
+		case uint64:
+			out.Write(strconv.AppendUint(scratch[:0], v, 10))
+		case error:
+			writeLogfmtValue(out, v.Error())
+		default:
+			writeLogfmtValue(out, fmt.Sprint(v))
+		}
+	}
+	out.WriteByte('\n')
+}
+
+// Format returns the record as a line of logfmt.
+func (f *LogfmtFormatter) Format(rec *LogRecord) string {
+	out := getBuffer()
+	defer putBuffer(out)
+	f.FormatRecord(out, rec)
+	return out.String()
+}
+
+// Reports whether a character must be quoted in a logfmt value, or replaced in
+// a key
+func logfmtSpecial(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || r == 0x7f
+}
+
+// Write a key, replacing the characters which are not allowed in it
+func writeLogfmtKey(out *bytes.Buffer, key string) {
+	if len(key) == 0 {
+		out.WriteByte('_')
+		return
+	}
+	for _, r := range key {
+		if logfmtSpecial(r) {
+			r = '_'
+		}
+		out.WriteRune(r)
+	}
+}
+
+// Write a value, quoting and escaping it if necessary
+func writeLogfmtValue(out *bytes.Buffer, value string) {
+	if len(value) > 0 && strings.IndexFunc(value, logfmtSpecial) < 0 {
+		out.WriteString(value)
+		return
+	}
+
+	out.WriteByte('"')
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r < ' ' || r == 0x7f:
+			out.WriteString(`\u00`)
+			out.WriteByte(hexDigits[r>>4])
+			out.WriteByte(hexDigits[r&0xF])
+		default:
+			// Invalid UTF-8 was decoded as utf8.RuneError, and is written as such
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+}
+
+// ParseLogfmt parses a line of logfmt into its key/value pairs, in order.  The
+// values are strings, except that a key without an equals sign has a nil
+// value.  Quoted values are unescaped.
+func ParseLogfmt(line string) (Fields, error) {
+	line = strings.TrimRight(line, "\r\n")
+
+	var fields Fields
+	for i := 0; ; {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i == len(line) {
+			return fields, nil
+		}
+
+		start := i
+		for i < len(line) && !logfmtSpecial(rune(line[i])) {
+			i++
+		}
+		key := line[start:i]
+		if len(key) == 0 {
+			return nil, fmt.Errorf("ParseLogfmt: unexpected %q at column %d", line[i], i+1)
+		}
+		if i == len(line) || line[i] == ' ' || line[i] == '\t' {
+			fields = append(fields, Field{key, nil})
+			continue
+		}
+		if line[i] != '=' {
+			return nil, fmt.Errorf("ParseLogfmt: unexpected %q in key at column %d", line[i], i+1)
+		}
+		i++
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("ParseLogfmt: unterminated quoted value for %q", key)
+			}
+			var err error
+			if value, err = strconv.Unquote(line[i : end+1]); err != nil {
+				return nil, fmt.Errorf("ParseLogfmt: invalid quoted value for %q: %s", key, line[i:end+1])
+			}
+			i = end + 1
+			if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				return nil, fmt.Errorf("ParseLogfmt: unexpected %q after quoted value at column %d", line[i], i+1)
+			}
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				if line[i] == '"' || line[i] == '=' {
+					return nil, fmt.Errorf("ParseLogfmt: unexpected %q in value at column %d", line[i], i+1)
+				}
+				i++
+			}
+			value = line[start:i]
+		}
+		fields = append(fields, Field{key, value})
+	}
+}
+
+// ParseRecord parses a line written by the formatter back into a record.  The
+// pairs which are not under one of the formatter's keys become the record's
+// Fields, whose values are strings (see ParseLogfmt).
+func (f *LogfmtFormatter) ParseRecord(line string) (*LogRecord, error) {
+	fields, err := ParseLogfmt(line)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &LogRecord{}
+	for _, field := range fields {
+		value, _ := field.Value.(string)
+		switch {
+		case len(f.TimeKey) > 0 && field.Key == f.TimeKey:
+			rec.Created, err = time.Parse(time.RFC3339Nano, value)
+		case len(f.LevelKey) > 0 && field.Key == f.LevelKey:
+			rec.Level, err = ParseLevel(value)
+		case len(f.SourceKey) > 0 && field.Key == f.SourceKey:
+			rec.Source = value
+		case len(f.MessageKey) > 0 && field.Key == f.MessageKey:
+			rec.Message = value
+		case len(f.StackKey) > 0 && field.Key == f.StackKey:
+			rec.Stack = value
+		default:
+			rec.Fields = append(rec.Fields, field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ParseRecord: invalid %s: %s", field.Key, err)
+		}
+	}
+	return rec, nil
+}
+
+// NewLogfmtLogWriter is a utility method for creating a FileLogWriter set up to
+// output a line of logfmt for each record (see LogfmtFormatter).
+func NewLogfmtLogWriter(fname string, rotate bool) *FileLogWriter {
+	w := NewFileLogWriter(fname, rotate, false)
+	if w == nil {
+		return nil
+	}
+	return w.SetFormatter(NewLogfmtFormatter())
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the activity of a Logger and the Loggers below it in
+// the hierarchy.
+type Stats struct {
+	// Records logged, by level name (e.g. "WARNING").  Records discarded
+	// because no Filter accepts their level are not counted.
+	Levels map[string]uint64
+
+	// The activity of each Filter, by name.  Filters of named Loggers are
+	// named "logger:filter".
+	Filters map[string]FilterStats
+}
+
+// FilterStats is a snapshot of the activity of a Filter and its LogWriter.
+// Counters which do not apply to the LogWriter are zero.
+type FilterStats struct {
+	Written          uint64 // Records accepted by the Filter and passed to the LogWriter
+	Dropped          uint64 // Records dropped because the LogWriter's buffer was full
+	Suppressed       uint64 // Records suppressed by a SamplingLogWriter
+	WriteFailures    uint64 // Records a FileLogWriter failed to write
+	RotationFailures uint64 // Failed rotations of a FileLogWriter
+}
+
+// Count a record logged to the category
+func (c *category) countRecord(lvl Level) {
+	count, ok := c.counts.Load(lvl)
+	if !ok {
+		count, _ = c.counts.LoadOrStore(lvl, new(uint64))
+	}
+	atomic.AddUint64(count.(*uint64), 1)
+}
+
+// Stats returns a snapshot of the activity of log and the Loggers below it in
+// the hierarchy.
+func (log Logger) Stats() Stats {
+	stats := Stats{
+		Levels:  make(map[string]uint64),
+		Filters: make(map[string]FilterStats),
+	}
+	for _, cat := range log.subtree() {
+		cat.counts.Range(func(lvl, count interface{}) bool {
+			stats.Levels[lvl.(Level).Name()] += atomic.LoadUint64(count.(*uint64))
+			return true
+		})
+		for name, filt := range cat.loadFilters() {
+			if len(cat.name) > 0 {
+				name = cat.name + ":" + name
+			}
+			stats.Filters[name] = filt.stats()
+		}
+	}
+	return stats
+}
+
+// Collect the counters of the filter and of its LogWriter, and of any
+// LogWriters the latter wraps
+func (f *Filter) stats() FilterStats {
+	stats := FilterStats{
+		Written: atomic.LoadUint64(&f.written),
+	}
+	for w := f.LogWriter; w != nil; {
+		switch writer := w.(type) {
+		case *FileLogWriter:
+			stats.WriteFailures += writer.WriteFailures()
+			stats.RotationFailures += writer.RotationFailures()
+		case *SamplingLogWriter:
+			stats.Suppressed += writer.Suppressed()
+		}
+		if d, ok := w.(interface{ Dropped() uint64 }); ok {
+			stats.Dropped += d.Dropped()
+		}
+		wrapper, ok := w.(wrappingWriter)
+		if !ok {
+			break
+		}
+		w = wrapper.unwrap()
+	}
+	return stats
+}
+
+// PublishExpvar publishes the Stats of log through expvar under the given name,
+// e.g. Global.PublishExpvar("log4go"), so that they are served at /debug/vars
+// when expvar's handler is installed.  Like expvar.Publish, it panics if the
+// name is already in use.
+func (log Logger) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return log.Stats()
+	}))
+}
@@ -4,8 +4,14 @@ package log4go
 
 import (
 	"bytes"
-	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -15,24 +21,6 @@ const (
 	FORMAT_ABBREV  = "[%L] %M"
 )
 
-var dateFormatCache = &struct {
-	// Date when the cached value was recomputed
-	lastYear, lastMonth, lastDay int
-	longDate, shortDate          string
-}{}
-
-var timeFormatCache = &struct {
-	// Second since the epoch when the cached value was recomputed
-	lastSecond          int64
-	longTime, shortTime string
-}{}
-
-var millisFormatCache = &struct {
-	// Millisecond since the epoch when the cached value was recomputed
-	lastMillis int64
-	millisTime string
-}{}
-
 // Known format codes:
 // %A - Time w/ milliseconds (15:04:05.000)
 // %T - Time (15:04:05 MST)
@@ -41,7 +29,26 @@ var millisFormatCache = &struct {
 // %d - Date (01/02/06)
 // %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)
 // %S - Source
+// %N - Function of the caller (main.main)
+// %s - File name and line of the caller (main.go:12)
+// %C - Full path and line of the caller (/src/cmd/main.go:12)
 // %M - Message
+// %F - Fields (key=value key=value)
+// %K - Stack trace, if one was captured (see WithStackLevel)
+// %X - Fields as XML <field> elements, and any stack trace as a <stack>
+//      element, each on its own line
+// %l - Full level name (FINEST, FINE, DEBUG, TRACE, INFO, WARNING, ERROR, CRITICAL)
+// %u - Time w/ microseconds (15:04:05.000000)
+// %n - Time w/ nanoseconds (15:04:05.000000000)
+// %I - ISO 8601 date and time w/ milliseconds and offset (2006-01-02T15:04:05.000-07:00)
+// %U - ISO 8601 date and time in UTC w/ milliseconds (2006-01-02T15:04:05.000Z)
+// %E - Seconds since the program started, w/ milliseconds (12.345)
+// %R - Sequence number of the record, counting from 1 when the program started
+// %G - ID of the goroutine which logged the record
+// %P - Process ID
+// %H - Host name
+// %p - Program name (the base name of os.Args[0])
+// %% - A percent sign
 // Ignores unknown formats
 // Recommended: "[%D %T] [%L] (%S) %M"
 func FormatLogRecord(format string, rec *LogRecord) string {
@@ -51,98 +58,327 @@ func FormatLogRecord(format string, rec *LogRecord) string {
 	if len(format) == 0 {
 		return ""
 	}
+	return compiledFormat(format).Format(rec)
+}
+
+// A Formatter renders records for a LogWriter, such as a FileLogWriter (see
+// SetFormatter).  A Formatter may be used by several goroutines at once.
+type Formatter interface {
+	// FormatRecord appends the record, followed by a newline, to out.
+	FormatRecord(out *bytes.Buffer, rec *LogRecord)
+}
+
+// A CompiledFormat is a format string (see FormatLogRecord) which has been
+// parsed once, so that records can be formatted without parsing it again.  It
+// is never modified, so it may be shared by any number of goroutines.  It is
+// the Formatter used by LogWriters which are given a format string.
+type CompiledFormat struct {
+	format string
+	pieces []formatPiece
+}
 
-	out := bytes.NewBuffer(make([]byte, 0, 64))
-	millis := rec.Created.UnixNano() / 1e6
-	seconds := millis / 1000
-	hour, minute, second := rec.Created.Hour(), rec.Created.Minute(), rec.Created.Second()
-
-	// Check if we need to recompute the millisecond cache
-	if millisFormatCache.lastMillis != millis {
-		nano := rec.Created.Nanosecond()
-		millisString := fmt.Sprintf("%02d:%02d:%02d.%03d", hour, minute, second, nano/1e6)
-		millisFormatCache.lastMillis = millis
-		millisFormatCache.millisTime = millisString
+// A piece of a format string: either a format code, or literal text
+type formatPiece struct {
+	code byte
+	text string
+}
+
+// CompileFormat parses a format string for FormatLogRecord.  The character
+// after each % is a format code, except that %% is a percent sign.  A % at the
+// end of the format is ignored.
+func CompileFormat(format string) *CompiledFormat {
+	f := &CompiledFormat{format: format}
+	for i := 0; i < len(format); i++ {
+		n := strings.IndexByte(format[i:], '%')
+		if n < 0 {
+			f.addText(format[i:])
+			break
+		}
+		f.addText(format[i : i+n])
+		if i += n + 1; i == len(format) {
+			break
+		}
+		switch code := format[i]; code {
+		case '%':
+			f.addText("%")
+		case 'G':
+			// Goroutine IDs are only looked up once a format needs them
+			atomic.StoreInt32(&goroutineIDs, 1)
+			fallthrough
+		default:
+			f.pieces = append(f.pieces, formatPiece{code: code})
+		}
 	}
+	return f
+}
 
-	// Check if we need to recompute the second cache
-	if timeFormatCache.lastSecond != seconds {
-		zone, _ := rec.Created.Zone()
-		timeFormatCache.lastSecond = seconds
-		timeFormatCache.longTime = fmt.Sprintf("%02d:%02d:%02d %s", hour, minute, second, zone)
-		timeFormatCache.shortTime = fmt.Sprintf("%02d:%02d", hour, minute)
+// Append literal text to the format, joining it to any text before it
+func (f *CompiledFormat) addText(text string) {
+	if len(text) == 0 {
+		return
 	}
+	if last := len(f.pieces) - 1; last >= 0 && f.pieces[last].code == 0 {
+		f.pieces[last].text += text
+		return
+	}
+	f.pieces = append(f.pieces, formatPiece{text: text})
+}
 
-	// Check if we need to recompute the date cache
-	month, day, year := rec.Created.Month(), rec.Created.Day(), rec.Created.Year()
-	if dateFormatCache.lastDay != day || dateFormatCache.lastMonth != int(month) || dateFormatCache.lastYear != year {
-		dateFormatCache.lastDay = day
-		dateFormatCache.lastMonth = int(month)
-		dateFormatCache.lastYear = year
-		dateFormatCache.shortDate = fmt.Sprintf("%02d/%02d/%02d", month, day, year%100)
-		dateFormatCache.longDate = fmt.Sprintf("%04d/%02d/%02d", year, month, day)
+// String returns the format string the CompiledFormat was compiled from.
+func (f *CompiledFormat) String() string {
+	return f.format
+}
+
+// Format formats a record like FormatLogRecord.
+func (f *CompiledFormat) Format(rec *LogRecord) string {
+	if rec == nil {
+		return "<nil>"
+	}
+	if len(f.format) == 0 {
+		return ""
 	}
 
-	// Split the string into pieces by % signs
-	pieces := bytes.Split([]byte(format), []byte{'%'})
-
-	// Iterate over the pieces, replacing known formats
-	for i, piece := range pieces {
-		if i > 0 && len(piece) > 0 {
-			switch piece[0] {
-			case 'A':
-				out.WriteString(millisFormatCache.millisTime)
-			case 'T':
-				out.WriteString(timeFormatCache.longTime)
-			case 't':
-				out.WriteString(timeFormatCache.shortTime)
-			case 'D':
-				out.WriteString(dateFormatCache.longDate)
-			case 'd':
-				out.WriteString(dateFormatCache.shortDate)
-			case 'L':
-				out.WriteString(levelStrings[rec.Level])
-			case 'S':
-				out.WriteString(rec.Source)
-			case 'M':
-				out.WriteString(rec.Message)
+	out := getBuffer()
+	defer putBuffer(out)
+	f.FormatRecord(out, rec)
+	return out.String()
+}
+
+// FormatRecord appends the formatted record to out.
+func (f *CompiledFormat) FormatRecord(out *bytes.Buffer, rec *LogRecord) {
+	if len(f.format) == 0 {
+		return
+	}
+
+	var scratch [64]byte
+	for _, piece := range f.pieces {
+		switch piece.code {
+		case 0:
+			out.WriteString(piece.text)
+		case 'A':
+			hour, minute, second := rec.Created.Clock()
+			writeClock(out, hour, minute, second)
+			out.WriteByte('.')
+			writeInt(out, rec.Created.Nanosecond()/1e6, 3)
+		case 'T':
+			hour, minute, second := rec.Created.Clock()
+			zone, _ := rec.Created.Zone()
+			writeClock(out, hour, minute, second)
+			out.WriteByte(' ')
+			out.WriteString(zone)
+		case 't':
+			hour, minute, _ := rec.Created.Clock()
+			writeInt(out, hour, 2)
+			out.WriteByte(':')
+			writeInt(out, minute, 2)
+		case 'D':
+			year, month, day := rec.Created.Date()
+			writeInt(out, year, 4)
+			out.WriteByte('/')
+			writeInt(out, int(month), 2)
+			out.WriteByte('/')
+			writeInt(out, day, 2)
+		case 'd':
+			year, month, day := rec.Created.Date()
+			writeInt(out, int(month), 2)
+			out.WriteByte('/')
+			writeInt(out, day, 2)
+			out.WriteByte('/')
+			writeInt(out, year%100, 2)
+		case 'L':
+			out.WriteString(rec.Level.String())
+		case 'S':
+			out.WriteString(rec.Source)
+		case 'N', 's', 'C':
+			rec.writeCaller(out, piece.code)
+		case 'M':
+			out.WriteString(rec.Message)
+		case 'F':
+			rec.Fields.writeText(out)
+		case 'K':
+			out.WriteString(rec.Stack)
+		case 'X':
+			rec.Fields.writeXML(out)
+			rec.writeStackXML(out)
+		case 'l':
+			out.WriteString(rec.Level.Name())
+		case 'u', 'n':
+			hour, minute, second := rec.Created.Clock()
+			writeClock(out, hour, minute, second)
+			out.WriteByte('.')
+			if piece.code == 'u' {
+				writeInt(out, rec.Created.Nanosecond()/1e3, 6)
+			} else {
+				writeInt(out, rec.Created.Nanosecond(), 9)
 			}
-			if len(piece) > 1 {
-				out.Write(piece[1:])
+		case 'I':
+			out.Write(rec.Created.AppendFormat(scratch[:0], "2006-01-02T15:04:05.000Z07:00"))
+		case 'U':
+			out.Write(rec.Created.UTC().AppendFormat(scratch[:0], "2006-01-02T15:04:05.000Z"))
+		case 'E':
+			elapsed := rec.Created.Sub(startTime)
+			if elapsed < 0 {
+				out.WriteByte('-')
+				elapsed = -elapsed
 			}
-		} else if len(piece) > 0 {
-			out.Write(piece)
+			writeInt(out, int(elapsed/time.Second), 1)
+			out.WriteByte('.')
+			writeInt(out, int(elapsed%time.Second/time.Millisecond), 3)
+		case 'R':
+			out.Write(strconv.AppendUint(scratch[:0], rec.seq, 10))
+		case 'G':
+			out.Write(strconv.AppendUint(scratch[:0], rec.goroutine, 10))
+		case 'P':
+			writeInt(out, pid, 1)
+		case 'H':
+			out.WriteString(hostname)
+		case 'p':
+			out.WriteString(program)
 		}
 	}
 	out.WriteByte('\n')
+}
 
-	return out.String()
+// Details of the process for the %P, %H, %p and %E format codes
+var (
+	pid         = os.Getpid()
+	hostname, _ = os.Hostname()
+	program     = programName()
+	startTime   = time.Now()
+)
+
+// Write a time of day as 15:04:05
+func writeClock(out *bytes.Buffer, hour, minute, second int) {
+	writeInt(out, hour, 2)
+	out.WriteByte(':')
+	writeInt(out, minute, 2)
+	out.WriteByte(':')
+	writeInt(out, second, 2)
+}
+
+// Write n in decimal, padded with zeros to at least width digits
+func writeInt(out *bytes.Buffer, n, width int) {
+	var digits [20]byte
+	b := strconv.AppendInt(digits[:0], int64(n), 10)
+	for i := len(b); i < width; i++ {
+		out.WriteByte('0')
+	}
+	out.Write(b)
+}
+
+func programName() string {
+	if len(os.Args) == 0 {
+		return ""
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// The most formats FormatLogRecord keeps compiled, in case formats are being
+// generated
+const maxCompiledFormats = 64
+
+var compiledFormats = &struct {
+	sync.RWMutex
+	formats map[string]*CompiledFormat
+}{
+	formats: make(map[string]*CompiledFormat),
+}
+
+// Returns the compiled format string, compiling it the first time it is used
+func compiledFormat(format string) *CompiledFormat {
+	compiledFormats.RLock()
+	f, ok := compiledFormats.formats[format]
+	compiledFormats.RUnlock()
+	if ok {
+		return f
+	}
+
+	f = CompileFormat(format)
+	compiledFormats.Lock()
+	if len(compiledFormats.formats) < maxCompiledFormats {
+		compiledFormats.formats[format] = f
+	}
+	compiledFormats.Unlock()
+	return f
 }
 
 // This is the standard writer that prints to standard output.
-type FormatLogWriter chan *LogRecord
+type FormatLogWriter struct {
+	queue     *recordQueue
+	completed chan int
+	formatter Formatter
+}
 
 // This creates a new FormatLogWriter
-func NewFormatLogWriter(out io.Writer, format string) FormatLogWriter {
-	records := make(FormatLogWriter, LogBufferLength)
-	go records.run(out, format)
-	return records
+func NewFormatLogWriter(out io.Writer, format string) *FormatLogWriter {
+	w := &FormatLogWriter{
+		queue:     newRecordQueue(),
+		completed: make(chan int),
+		formatter: CompileFormat(format),
+	}
+	go w.run(out)
+	return w
 }
 
-func (w FormatLogWriter) run(out io.Writer, format string) {
-	for rec := range w {
-		fmt.Fprint(out, FormatLogRecord(format, rec))
+func (w *FormatLogWriter) run(out io.Writer) {
+	buf := new(bytes.Buffer)
+	write := func(rec *LogRecord) {
+		buf.Reset()
+		w.formatter.FormatRecord(buf, rec)
+		out.Write(buf.Bytes())
 	}
+
+	w.queue.drain(write)
+	close(w.completed)
+}
+
+// This is the FormatLogWriter's output method.  The record is formatted and
+// written by another goroutine, so this only blocks while the buffer of records
+// waiting for it is full (see SetOverflowPolicy).
+func (w *FormatLogWriter) LogWrite(rec *LogRecord) {
+	w.queue.put(rec)
+}
+
+// Close writes the remaining records and stops the FormatLogWriter's goroutine.
+// The io.Writer is not closed.  Attempts to send log messages to this logger
+// after a Close have undefined behavior.
+func (w *FormatLogWriter) Close() {
+	close(w.queue.records)
+	<-w.completed
+}
+
+// Flush blocks until the records logged before it have been written to the
+// io.Writer.
+func (w *FormatLogWriter) Flush() {
+	w.queue.flush()
+}
+
+// SetFormatter replaces the format with a Formatter, such as a JSONFormatter
+// (chainable).  Must be called before the first log message is written.
+func (w *FormatLogWriter) SetFormatter(f Formatter) *FormatLogWriter {
+	w.formatter = f
+	return w
+}
+
+// SetOverflowPolicy sets what happens to records logged while the io.Writer is
+// falling behind (chainable).  The timeout is only used by OVERFLOW_TIMEOUT.
+func (w *FormatLogWriter) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) *FormatLogWriter {
+	w.queue.setOverflowPolicy(policy, timeout)
+	return w
+}
+
+// Dropped returns the number of records which were never written because of
+// the OverflowPolicy.
+func (w *FormatLogWriter) Dropped() uint64 {
+	return w.queue.droppedRecords()
 }
 
-// This is the FormatLogWriter's output method.  This will block if the output
-// buffer is full.
-func (w FormatLogWriter) LogWrite(rec *LogRecord) {
-	w <- rec
+// Returns the number of records yet to be formatted
+func (w *FormatLogWriter) queued() int {
+	return len(w.queue.records)
 }
 
-// Close stops the logger from sending messages to standard output.  Attempts to
-// send log messages to this logger after a Close have undefined behavior.
-func (w FormatLogWriter) Close() {
-	close(w)
+// The writer goroutine releases the records once it has formatted them
+func (w *FormatLogWriter) releases() bool {
+	return true
 }
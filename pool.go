@@ -0,0 +1,79 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// Buffers larger than this are not returned to the pool, so that one huge
+// record does not pin its buffer for the life of the program
+const maxPooledBuffer = 64 << 10
+
+var recordPool = sync.Pool{
+	New: func() interface{} { return new(LogRecord) },
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return bytes.NewBuffer(make([]byte, 0, 256)) },
+}
+
+// Implemented by LogWriters which release each record passed to LogWrite once
+// they are done with it (and any they don't write), so that pooled records can
+// be reused.  Every LogWriter in this package does; any other LogWriter is
+// assumed to keep the records it is given.
+type releasingWriter interface {
+	releases() bool
+}
+
+// Reports whether w releases the records passed to its LogWrite
+func releases(w LogWriter) bool {
+	r, ok := w.(releasingWriter)
+	return ok && r.releases()
+}
+
+// Returns a record from the pool, holding the only reference to it
+func pooledRecord() *LogRecord {
+	rec := recordPool.Get().(*LogRecord)
+	rec.refs, rec.recycle = 1, 1
+	return rec
+}
+
+// Take another reference to the record for a LogWriter, which releases it when
+// it is done with it.  Only called by a holder of a reference.
+func (rec *LogRecord) retain() {
+	atomic.AddInt32(&rec.refs, 1)
+}
+
+// Keep the record from ever being recycled, because it was passed to a
+// LogWriter which may keep it
+func (rec *LogRecord) pin() {
+	atomic.StoreInt32(&rec.recycle, 0)
+}
+
+// Release a reference to the record, returning it to the pool once the last
+// one is released.  Records which were not taken from the pool, or which have
+// been pinned, are left to the garbage collector.
+func (rec *LogRecord) release() {
+	if atomic.AddInt32(&rec.refs, -1) != 0 || atomic.LoadInt32(&rec.recycle) == 0 {
+		return
+	}
+	*rec = LogRecord{}
+	recordPool.Put(rec)
+}
+
+// Returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	out := bufferPool.Get().(*bytes.Buffer)
+	out.Reset()
+	return out
+}
+
+// Returns a buffer to the pool
+func putBuffer(out *bytes.Buffer) {
+	if out.Cap() <= maxPooledBuffer {
+		bufferPool.Put(out)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"regexp"
+)
+
+// A Predicate decides whether a Filter writes a record: the record is only
+// written if every Predicate of the Filter returns true.  Predicates are called
+// from the logging goroutine and must not modify the record.
+type Predicate func(rec *LogRecord) bool
+
+// SourceMatches returns a Predicate which accepts records whose Source matches
+// the regular expression.
+func SourceMatches(re *regexp.Regexp) Predicate {
+	return func(rec *LogRecord) bool {
+		return re.MatchString(rec.Source)
+	}
+}
+
+// MessageMatches returns a Predicate which accepts records whose Message
+// matches the regular expression.
+func MessageMatches(re *regexp.Regexp) Predicate {
+	return func(rec *LogRecord) bool {
+		return re.MatchString(rec.Message)
+	}
+}
+
+// Not returns a Predicate which accepts the records rejected by pred, e.g.
+//
+//	filt.AddPredicate(Not(SourceMatches(regexp.MustCompile(`^noisy/pkg\.`))))
+func Not(pred Predicate) Predicate {
+	return func(rec *LogRecord) bool {
+		return !pred(rec)
+	}
+}
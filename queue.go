@@ -0,0 +1,204 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// An OverflowPolicy determines what a LogWriter does with a record when its
+// buffer of LogBufferLength records is full.  The console, file, format and
+// socket LogWriters buffer the records passed to LogWrite for a goroutine which
+// writes them, so by default LogWrite blocks while that goroutine falls behind.
+type OverflowPolicy int32
+
+const (
+	OVERFLOW_BLOCK       OverflowPolicy = iota // Wait until there is room (the default)
+	OVERFLOW_DROP_NEWEST                       // Drop the record being written
+	OVERFLOW_DROP_OLDEST                       // Drop the oldest buffered record to make room
+	OVERFLOW_TIMEOUT                           // Wait until there is room, dropping the record after a timeout
+)
+
+var (
+	// OverflowReportInterval is the minimum time between the records a
+	// LogWriter writes to report how many records it has dropped.  A report is
+	// also written whenever the writer catches up with its buffer.
+	OverflowReportInterval = 10 * time.Second
+)
+
+// A recordQueue is the buffer between the goroutines logging records and the
+// goroutine writing them, which applies an OverflowPolicy when it is full.
+type recordQueue struct {
+	records chan *LogRecord
+
+	// Overflow settings (accessed atomically)
+	policy  int32
+	timeout int64
+
+	// Dropped record counters (accessed atomically)
+	dropped    uint64
+	unreported uint64
+
+	// When dropped records were last reported (writer goroutine only)
+	lastReport time.Time
+}
+
+func newRecordQueue() *recordQueue {
+	return &recordQueue{
+		records: make(chan *LogRecord, LogBufferLength),
+	}
+}
+
+func (q *recordQueue) setOverflowPolicy(policy OverflowPolicy, timeout time.Duration) {
+	atomic.StoreInt64(&q.timeout, int64(timeout))
+	atomic.StoreInt32(&q.policy, int32(policy))
+}
+
+func (q *recordQueue) drop() {
+	atomic.AddUint64(&q.dropped, 1)
+	atomic.AddUint64(&q.unreported, 1)
+}
+
+// Returns the number of records dropped since the queue was created
+func (q *recordQueue) droppedRecords() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// Block until the writer goroutine has reached every record queued before the
+// call, by queueing a record for it to acknowledge.  The record is queued even
+// if the queue is full, regardless of the overflow policy.
+func (q *recordQueue) flush() {
+	done := make(chan struct{})
+	q.records <- &LogRecord{flushed: done}
+	<-done
+}
+
+// Called by the writer goroutine for each record it receives.  Acknowledges the
+// record and returns true if it was queued by flush, in which case it must not
+// be written.
+func (q *recordQueue) flushed(rec *LogRecord) bool {
+	if rec.flushed == nil {
+		return false
+	}
+	close(rec.flushed)
+	return true
+}
+
+// Called by the writer goroutine with each record it receives, and with ok
+// false once the queue has been closed.  Passes the record to write and
+// releases it, followed by a report of any dropped records.  Returns false once
+// the queue has been closed, after writing the final report.
+func (q *recordQueue) receive(rec *LogRecord, ok bool, write func(rec *LogRecord)) bool {
+	if !ok {
+		if report := q.dropReport(true); report != nil {
+			write(report)
+		}
+		return false
+	}
+	if q.flushed(rec) {
+		return true
+	}
+	write(rec)
+	rec.release()
+	if report := q.dropReport(false); report != nil {
+		write(report)
+	}
+	return true
+}
+
+// Run by the writer goroutine to pass every record to write until the queue
+// is closed (see receive)
+func (q *recordQueue) drain(write func(rec *LogRecord)) {
+	for rec := range q.records {
+		q.receive(rec, true, write)
+	}
+	q.receive(nil, false, write)
+}
+
+// Queue a record, applying the overflow policy if the queue is full.  Records
+// which are dropped are released.
+func (q *recordQueue) put(rec *LogRecord) {
+	switch OverflowPolicy(atomic.LoadInt32(&q.policy)) {
+	case OVERFLOW_DROP_NEWEST:
+		select {
+		case q.records <- rec:
+		default:
+			q.drop()
+			rec.release()
+		}
+	case OVERFLOW_DROP_OLDEST:
+		// Without a buffer there is never an older record to drop
+		if cap(q.records) == 0 {
+			select {
+			case q.records <- rec:
+			default:
+				q.drop()
+				rec.release()
+			}
+			return
+		}
+		for {
+			select {
+			case q.records <- rec:
+				return
+			default:
+			}
+			select {
+			case old := <-q.records:
+				if old.flushed == nil {
+					q.drop()
+					old.release()
+					continue
+				}
+				// The record before a flush may still be being written, so
+				// the flush must be left for the writer goroutine to reach.
+				// It is queued again, and the record waits for room behind
+				// it rather than dropping the records logged after it.
+				q.records <- old
+				q.records <- rec
+				return
+			default:
+			}
+		}
+	case OVERFLOW_TIMEOUT:
+		select {
+		case q.records <- rec:
+			return
+		default:
+		}
+		timer := time.NewTimer(time.Duration(atomic.LoadInt64(&q.timeout)))
+		defer timer.Stop()
+		select {
+		case q.records <- rec:
+		case <-timer.C:
+			q.drop()
+			rec.release()
+		}
+	default:
+		q.records <- rec
+	}
+}
+
+// Called by the writer goroutine after each record it writes.  Returns a
+// record reporting the number of dropped records if any have been dropped
+// since the last report, and the writer has caught up or the report interval
+// has elapsed (or final is set, when the writer is closing).  Otherwise
+// returns nil.
+func (q *recordQueue) dropReport(final bool) *LogRecord {
+	if atomic.LoadUint64(&q.unreported) == 0 {
+		return nil
+	}
+	now := time.Now()
+	if !final && len(q.records) > 0 && now.Sub(q.lastReport) < OverflowReportInterval {
+		return nil
+	}
+	q.lastReport = now
+	return &LogRecord{
+		Level:   WARNING,
+		Created: now,
+		Source:  "log4go",
+		Message: fmt.Sprintf("dropped %d records", atomic.SwapUint64(&q.unreported, 0)),
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Recover logs a panic in progress, if any, to the Global logger, and stops
+// the panic.  It must be deferred directly:
+//
+//	defer log4go.Recover()
+//
+// See Logger.Recover.
+func Recover() {
+	if r := recover(); r != nil {
+		Global.logPanic(r)
+	}
+}
+
+// GoSafe runs f in a new goroutine, logging any panic to the Global logger
+// and stopping it rather than crashing the program.
+func GoSafe(f func()) {
+	Global.GoSafe(f)
+}
+
+// Recover logs a panic in progress, if any, at CRITICAL with the panic value
+// and the stack of the goroutine, and flushes every LogWriter in the hierarchy
+// of log.  If rethrow is true, the panic then continues; otherwise it is
+// stopped.  It must be deferred directly:
+//
+//	defer log.Recover(true)
+func (log Logger) Recover(rethrow bool) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.logPanic(r)
+	if rethrow {
+		panic(r)
+	}
+}
+
+// GoSafe runs f in a new goroutine, logging any panic to log and stopping it
+// rather than crashing the program.
+func (log Logger) GoSafe(f func()) {
+	go func() {
+		defer log.Recover(false)
+		f()
+	}()
+}
+
+// Log the value of a recovered panic and flush every writer.  Must be called
+// from a function deferred by the panicking goroutine.
+func (log Logger) logPanic(r interface{}) {
+	if !log.skip(CRITICAL) {
+		rec := &LogRecord{
+			Level:   CRITICAL,
+			Created: time.Now(),
+			Message: fmt.Sprintf("panic: %v", r),
+			Fields:  log.fields,
+			Stack:   strings.TrimRight(string(debug.Stack()), "\n"),
+		}
+		rec.pc, rec.Source = log.panicker()
+		log.dispatch(rec)
+	}
+	Logger{category: log.root()}.Flush()
+}
+
+// Find the function which panicked, which is the first one outside of the
+// runtime called by runtime.gopanic.
+func (log Logger) panicker() (uintptr, string) {
+	if log.sourceFormat == SOURCE_NONE {
+		return 0, ""
+	}
+
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(1, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return frame.PC + 1, log.source(frame)
+		}
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		}
+		if !more {
+			return 0, ""
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The text which replaces redacted values
+const REDACTED = "[REDACTED]"
+
+// A redaction rule replaces the matches of a pattern, except for the text
+// matched by a submatch named "keep" at its start
+type redactRule struct {
+	pattern *regexp.Regexp
+	valid   func(match string) bool // If set, only matches it accepts are redacted
+}
+
+// The built-in detectors, by name
+var redactDetectors = map[string]redactRule{
+	// password=..., secret: ..., etc.
+	"password": {pattern: regexp.MustCompile(`(?i)(?P<keep>\b(?:password|passwd|pwd|secret|api_?key|token)\b\s*[=:]\s*)[^\s,;&]+`)},
+	// Authorization: Bearer ...
+	"bearer": {pattern: regexp.MustCompile(`(?i)(?P<keep>\bbearer\s+)[A-Za-z0-9\-._~+/]+=*`)},
+	// AWS access key IDs
+	"awskey": {pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	// Payment card numbers, optionally grouped with spaces or dashes
+	"card": {pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: luhnValid},
+	// Email addresses
+	"email": {pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+}
+
+// Field keys whose values are always redacted entirely
+var redactKeys = regexp.MustCompile(`(?i)^(?:password|passwd|pwd|secret|token|api_?key|authorization|cookie)$`)
+
+// Reports whether the digits in s pass the Luhn checksum used by card numbers
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// RedactDetectors returns the names of the built-in detectors.
+func RedactDetectors() []string {
+	names := make([]string, 0, len(redactDetectors))
+	for name := range redactDetectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A Redactor masks secrets and personal data in the Message and Fields of
+// records.  Field values are searched like the message, as the text they are
+// rendered as (the message of an error, or fmt.Sprint of anything other than a
+// string, []byte, bool or number), and a value in which anything is masked is
+// replaced by the masked text.  The values of fields with names like
+// "password" or "token" are masked entirely.
+type Redactor struct {
+	rules []redactRule
+}
+
+// NewRedactor returns a Redactor which uses the named built-in detectors (see
+// RedactDetectors), or all of them if no names are given.
+func NewRedactor(detectors ...string) (*Redactor, error) {
+	if len(detectors) == 0 {
+		detectors = RedactDetectors()
+	}
+	r := &Redactor{}
+	for _, name := range detectors {
+		rule, ok := redactDetectors[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("NewRedactor: unknown detector %q", name)
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// AddPattern adds a pattern whose matches are masked (chainable).  If the
+// pattern has a submatch named "keep", such as `(?P<keep>ssn=)\d+`, the text
+// it matches at the start of the match is kept.  Must be called before the
+// Redactor is used.
+func (r *Redactor) AddPattern(pattern *regexp.Regexp) *Redactor {
+	r.rules = append(r.rules, redactRule{pattern: pattern})
+	return r
+}
+
+// Mask every match of the rules in s
+func (r *Redactor) redactString(s string) string {
+	for _, rule := range r.rules {
+		switch {
+		case rule.valid != nil:
+			s = rule.pattern.ReplaceAllStringFunc(s, func(match string) string {
+				if !rule.valid(match) {
+					return match
+				}
+				return REDACTED
+			})
+		case rule.pattern.SubexpIndex("keep") > 0:
+			s = rule.pattern.ReplaceAllString(s, "${keep}"+REDACTED)
+		default:
+			s = rule.pattern.ReplaceAllLiteralString(s, REDACTED)
+		}
+	}
+	return s
+}
+
+// Redact returns the record with secrets masked.  If anything was masked, a
+// copy is returned, so that the record written to other Filters is unchanged.
+// Redact is a Hook, so it can also be added to a Logger to redact records for
+// every Filter.
+func (r *Redactor) Redact(rec *LogRecord) *LogRecord {
+	msg := r.redactString(rec.Message)
+
+	var fields Fields
+	for i, field := range rec.Fields {
+		var masked string
+		if redactKeys.MatchString(field.Key) {
+			masked = REDACTED
+		} else if s, ok := redactableText(field.Value); ok {
+			if masked = r.redactString(s); masked == s {
+				continue
+			}
+		} else {
+			continue
+		}
+		if fields == nil {
+			fields = make(Fields, len(rec.Fields))
+			copy(fields, rec.Fields)
+		}
+		fields[i].Value = masked
+	}
+
+	if msg == rec.Message && fields == nil {
+		return rec
+	}
+	// The record is copied field by field, since a pooled record's reference
+	// count may be changing
+	redacted := &LogRecord{
+		Level:   rec.Level,
+		Created: rec.Created,
+		Source:  rec.Source,
+		Message: msg,
+		Fields:  rec.Fields,
+		Stack:   rec.Stack,
+
+		pc:        rec.pc,
+		seq:       rec.seq,
+		goroutine: rec.goroutine,
+	}
+	if fields != nil {
+		redacted.Fields = fields
+	}
+	return redacted
+}
+
+// Returns the text of a field value which is searched for secrets, or false if
+// the value is of a type which cannot hold any
+func redactableText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr,
+		float32, float64, complex64, complex128:
+		return "", false
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case error:
+		return v.Error(), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// A RedactingLogWriter masks secrets in records with a Redactor before writing
+// them to another LogWriter.
+type RedactingLogWriter struct {
+	LogWriter
+	redactor *Redactor
+}
+
+// NewRedactingLogWriter returns a RedactingLogWriter which writes to w.
+func NewRedactingLogWriter(w LogWriter, r *Redactor) *RedactingLogWriter {
+	return &RedactingLogWriter{
+		LogWriter: w,
+		redactor:  r,
+	}
+}
+
+// This is the RedactingLogWriter's output method
+func (w *RedactingLogWriter) LogWrite(rec *LogRecord) {
+	redacted := w.redactor.Redact(rec)
+	w.LogWriter.LogWrite(redacted)
+	if redacted != rec && w.releases() {
+		rec.release()
+	}
+}
+
+// Returns the wrapped LogWriter
+func (w *RedactingLogWriter) unwrap() LogWriter {
+	return w.LogWriter
+}
+
+// Records are released by the wrapped LogWriter if it releases records, or
+// once they have been redacted if they had to be copied
+func (w *RedactingLogWriter) releases() bool {
+	return releases(w.LogWriter)
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The records of one level written during the current sampling interval
+type samplingWindow struct {
+	start time.Time
+	count int
+}
+
+// A SamplingLogWriter limits the rate of records written to another LogWriter.
+// In each interval it writes the first records of each level, and after that
+// only every Mth record of the level.  The number of records suppressed is
+// reported with a WARNING record when the next interval begins (and when the
+// writer is closed).
+type SamplingLogWriter struct {
+	LogWriter
+
+	interval   time.Duration
+	first      int
+	thereafter int
+
+	lock       sync.Mutex
+	windows    map[Level]*samplingWindow
+	unreported uint64
+
+	// Number of records suppressed (accessed atomically)
+	suppressed uint64
+}
+
+// NewSamplingLogWriter returns a SamplingLogWriter which writes the first
+// records of each level in every interval to w, followed by every
+// thereafter'th record of the level.  If thereafter is 0, the rest of the
+// records of the interval are suppressed.  For example, to write the first 100
+// records of each level per second and then every 10th:
+//
+//	NewSamplingLogWriter(w, time.Second, 100, 10)
+func NewSamplingLogWriter(w LogWriter, interval time.Duration, first, thereafter int) *SamplingLogWriter {
+	return &SamplingLogWriter{
+		LogWriter:  w,
+		interval:   interval,
+		first:      first,
+		thereafter: thereafter,
+		windows:    make(map[Level]*samplingWindow),
+	}
+}
+
+// This is the SamplingLogWriter's output method
+func (w *SamplingLogWriter) LogWrite(rec *LogRecord) {
+	var report *LogRecord
+	write := true
+
+	w.lock.Lock()
+	win, ok := w.windows[rec.Level]
+	if !ok {
+		win = &samplingWindow{start: rec.Created}
+		w.windows[rec.Level] = win
+	} else if rec.Created.Sub(win.start) >= w.interval || rec.Created.Before(win.start) {
+		win.start, win.count = rec.Created, 0
+		report = w.report(rec.Created)
+	}
+	win.count++
+	if n := win.count - w.first; n > 0 && (w.thereafter <= 0 || n%w.thereafter != 0) {
+		write = false
+		w.unreported++
+		atomic.AddUint64(&w.suppressed, 1)
+	}
+	w.lock.Unlock()
+
+	if report != nil {
+		w.LogWriter.LogWrite(report)
+	}
+	if write {
+		w.LogWriter.LogWrite(rec)
+	} else if w.releases() {
+		rec.release()
+	}
+}
+
+// Flush reports any records suppressed since the last report, and then flushes
+// the wrapped LogWriter.
+func (w *SamplingLogWriter) Flush() {
+	w.lock.Lock()
+	if report := w.report(time.Now()); report != nil {
+		w.LogWriter.LogWrite(report)
+	}
+	w.lock.Unlock()
+
+	w.LogWriter.Flush()
+}
+
+// Close reports any records suppressed since the last report, and then closes
+// the wrapped LogWriter.
+func (w *SamplingLogWriter) Close() {
+	w.lock.Lock()
+	report := w.report(time.Now())
+	w.lock.Unlock()
+
+	if report != nil {
+		w.LogWriter.LogWrite(report)
+	}
+	w.LogWriter.Close()
+}
+
+// Returns the wrapped LogWriter
+func (w *SamplingLogWriter) unwrap() LogWriter {
+	return w.LogWriter
+}
+
+// Suppressed records are released, and the rest are released by the wrapped
+// LogWriter if it releases records
+func (w *SamplingLogWriter) releases() bool {
+	return releases(w.LogWriter)
+}
+
+// Suppressed returns the number of records which have not been written because
+// of sampling.
+func (w *SamplingLogWriter) Suppressed() uint64 {
+	return atomic.LoadUint64(&w.suppressed)
+}
+
+// Returns a record reporting the records suppressed since the last report, or
+// nil if there are none.  Must be called with the lock held.
+func (w *SamplingLogWriter) report(now time.Time) *LogRecord {
+	if w.unreported == 0 {
+		return nil
+	}
+	rec := &LogRecord{
+		Level:   WARNING,
+		Created: now,
+		Source:  "log4go",
+		Message: fmt.Sprintf("suppressed %d records", w.unreported),
+	}
+	w.unreported = 0
+	return rec
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A CloseError is returned by CloseContext and CloseWithTimeout when some of
+// the LogWriters did not finish closing before the deadline.
+type CloseError struct {
+	// The filters whose LogWriters did not finish closing, named
+	// "logger:filter" for filters of named loggers
+	Unfinished []string
+
+	// The number of records still queued by those LogWriters at the deadline
+	Abandoned int
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("log4go: %d writer(s) did not close in time (%s), abandoning %d record(s)",
+		len(e.Unfinished), strings.Join(e.Unfinished, ", "), e.Abandoned)
+}
+
+// Implemented by LogWriters which queue records, to report how many are queued
+type queuedWriter interface {
+	queued() int
+}
+
+// Implemented by LogWriters which decorate another LogWriter
+type wrappingWriter interface {
+	unwrap() LogWriter
+}
+
+// Returns the number of records queued by w, or by the LogWriter it wraps
+func queuedRecords(w LogWriter) int {
+	for w != nil {
+		if q, ok := w.(queuedWriter); ok {
+			return q.queued()
+		}
+		wrapper, ok := w.(wrappingWriter)
+		if !ok {
+			break
+		}
+		w = wrapper.unwrap()
+	}
+	return 0
+}
+
+// CloseContext closes all log writers like Close, but gives up waiting for
+// them once ctx is done.  All of the filters are removed either way.  If some
+// of the LogWriters have not finished closing by then, a *CloseError naming
+// them is returned; they continue closing in the background for as long as the
+// program runs.
+func (log Logger) CloseContext(ctx context.Context) error {
+	type closing struct {
+		name string
+		filt *Filter
+		done chan struct{}
+	}
+
+	var all []closing
+	for _, cat := range log.subtree() {
+		old := cat.updateFilters(func(filters map[string]*Filter) {
+			for name := range filters {
+				delete(filters, name)
+			}
+		})
+		for name, filt := range old {
+			if len(cat.name) > 0 {
+				name = cat.name + ":" + name
+			}
+			c := closing{name, filt, make(chan struct{})}
+			go func() {
+				defer close(c.done)
+				c.filt.Close()
+			}()
+			all = append(all, c)
+		}
+	}
+
+	var unfinished *CloseError
+	for _, c := range all {
+		select {
+		case <-c.done:
+			continue
+		case <-ctx.Done():
+		}
+		// Check again, in case it finished at the same time
+		select {
+		case <-c.done:
+			continue
+		default:
+		}
+		if unfinished == nil {
+			unfinished = &CloseError{}
+		}
+		unfinished.Unfinished = append(unfinished.Unfinished, c.name)
+		unfinished.Abandoned += queuedRecords(c.filt.LogWriter)
+	}
+
+	if unfinished == nil {
+		return nil
+	}
+	sort.Strings(unfinished.Unfinished)
+	return unfinished
+}
+
+// CloseWithTimeout closes all log writers like Close, but waits at most d for
+// them to finish.  See CloseContext.
+func (log Logger) CloseWithTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return log.CloseContext(ctx)
+}
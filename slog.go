@@ -0,0 +1,152 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build go1.21
+// +build go1.21
+
+package log4go
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// A SlogHandler is a slog.Handler which writes records to a Logger, so that
+// code using log/slog shares its Filters and LogWriters.  Attributes become
+// Fields of the LogRecord, with the keys of attributes in groups qualified by
+// the group names, e.g. "request.id".
+type SlogHandler struct {
+	log    Logger
+	prefix string // The open groups, e.g. "request."
+}
+
+// NewSlogHandler returns a slog.Handler which writes to log:
+//
+//	slog.SetDefault(slog.New(log4go.NewSlogHandler(log4go.Global)))
+func NewSlogHandler(log Logger) *SlogHandler {
+	return &SlogHandler{log: log}
+}
+
+// FromSlogLevel maps a slog.Level onto a Level.  The standard slog levels map
+// onto DEBUG, INFO, WARNING and ERROR, levels four or more above ERROR onto
+// CRITICAL, and levels below DEBUG onto TRACE, FINE and FINEST in steps of
+// four.
+func FromSlogLevel(l slog.Level) Level {
+	switch {
+	case l >= slog.LevelError+4:
+		return CRITICAL
+	case l >= slog.LevelError:
+		return ERROR
+	case l >= slog.LevelWarn:
+		return WARNING
+	case l >= slog.LevelInfo:
+		return INFO
+	case l >= slog.LevelDebug:
+		return DEBUG
+	case l >= slog.LevelDebug-4:
+		return TRACE
+	case l >= slog.LevelDebug-8:
+		return FINE
+	}
+	return FINEST
+}
+
+// Enabled reports whether any Filter would write a record at the level, so
+// that disabled calls don't build a record at all.
+func (h *SlogHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return !h.log.skip(FromSlogLevel(l))
+}
+
+// Handle writes the record to the Filters of the Logger.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	log := h.log.withContext(ctx)
+
+	fields := make(Fields, len(log.fields), len(log.fields)+r.NumAttrs())
+	copy(fields, log.fields)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendSlogAttr(fields, h.prefix, a)
+		return true
+	})
+
+	// A handler may be given a record without a time, which slog's own handlers
+	// leave out; the record is stamped with the current time instead
+	created := r.Time
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	rec := pooledRecord()
+	rec.Level, rec.Created, rec.Message, rec.Fields = FromSlogLevel(r.Level), created, r.Message, fields
+	if r.PC != 0 && log.sourceFormat != SOURCE_NONE {
+		rec.pc, rec.Source = r.PC, log.cachedSource(r.PC)
+	}
+	rec.Stack = log.slogStack(rec.Level, r.PC)
+	log.dispatch(rec)
+	return nil
+}
+
+// Capture the stack of the caller of the slog.Logger method which called
+// Handle, if the level of the record calls for it.  The stack starts at the
+// program counter slog recorded for the call, wherever the slog.Logger method
+// is in the stack; nothing is captured if it is not in the stack at all.
+func (log Logger) slogStack(lvl Level, pc uintptr) string {
+	if pc == 0 || !log.wantStack(lvl) {
+		return ""
+	}
+
+	// Skip runtime.Callers, slogStack and Handle
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(3, pcs[:])
+	for i, p := range pcs[:n] {
+		if p == pc {
+			return formatCallers(pcs[i:n])
+		}
+	}
+	return ""
+}
+
+// WithAttrs returns a handler which adds the attributes to every record.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	fields := make(Fields, len(h.log.fields), len(h.log.fields)+len(attrs))
+	copy(fields, h.log.fields)
+	for _, a := range attrs {
+		fields = appendSlogAttr(fields, h.prefix, a)
+	}
+	clone := *h
+	clone.log.fields = fields
+	return &clone
+}
+
+// WithGroup returns a handler which qualifies the keys of subsequent
+// attributes with the group name.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// Append an attribute as a field, flattening groups into qualified keys and
+// ignoring empty attributes as slog handlers should
+func appendSlogAttr(fields Fields, prefix string, a slog.Attr) Fields {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if len(a.Key) > 0 {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendSlogAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{prefix + a.Key, a.Value.Any()})
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build go1.21
+// +build go1.21
+
+package log4go
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlogHandler(t *testing.T) {
+	out := &recordingWriter{}
+	l := NewLogger()
+	l.AddFilter("out", INFO, out)
+
+	logger := slog.New(NewSlogHandler(l.With("app", "test")))
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("Expected DEBUG to be disabled by the filter level")
+	}
+	logger.Debug("skipped")
+	logger.With("user", "bob").WithGroup("req").With("id", 7).Warn("slow",
+		slog.Group("db", "ms", 12), slog.Attr{}, "done", true)
+
+	if len(out.records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(out.records))
+	}
+	rec := out.records[0]
+	if rec.Level != WARNING || rec.Message != "slow" {
+		t.Errorf("Unexpected record: [%v] %q", rec.Level, rec.Message)
+	}
+	if got, want := rec.Fields.String(), "app=test user=bob req.id=7 req.db.ms=12 req.done=true"; got != want {
+		t.Errorf("Expected fields %q, got %q", want, got)
+	}
+	if !strings.Contains(rec.Source, ".TestSlogHandler:") {
+		t.Errorf("Expected the caller as source, got %q", rec.Source)
+	}
+	if rec.Stack != "" {
+		t.Errorf("Expected no stack without WithStackLevel, got:\n%s", rec.Stack)
+	}
+
+	if rec.Created.IsZero() {
+		t.Errorf("Expected the record to have a time")
+	}
+	NewSlogHandler(l).Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "untimed", 0))
+	if created := out.records[1].Created; created.IsZero() || time.Since(created) > time.Minute {
+		t.Errorf("Expected a record without a time to be stamped with the current time, got %v", created)
+	}
+	out.records = out.records[:1]
+
+	slog.New(NewSlogHandler(l.WithStackLevel(ERROR))).Error("failed")
+	if caller := strings.SplitN(out.records[1].Stack, "\n", 2)[0]; !strings.HasSuffix(caller, ".TestSlogHandler") {
+		t.Errorf("Expected the stack to start at the caller, got:\n%s", out.records[1].Stack)
+	}
+
+	levels := map[slog.Level]Level{
+		slog.LevelDebug - 12: FINEST,
+		slog.LevelDebug - 8:  FINE,
+		slog.LevelDebug - 4:  TRACE,
+		slog.LevelDebug:      DEBUG,
+		slog.LevelInfo:       INFO,
+		slog.LevelWarn:       WARNING,
+		slog.LevelError:      ERROR,
+		slog.LevelError + 4:  CRITICAL,
+	}
+	for sl, want := range levels {
+		if got := FromSlogLevel(sl); got != want {
+			t.Errorf("FromSlogLevel(%v) = %v, expected %v", sl, got, want)
+		}
+	}
+}
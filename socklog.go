@@ -7,50 +7,98 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"time"
 )
 
 // This log writer sends output to a socket
-type SocketLogWriter chan *LogRecord
+type SocketLogWriter struct {
+	queue     *recordQueue
+	completed chan int
+}
+
+// This is the SocketLogWriter's output method.  It only blocks while the buffer
+// of records waiting to be sent is full, unless an OverflowPolicy has been set.
+func (w *SocketLogWriter) LogWrite(rec *LogRecord) {
+	w.queue.put(rec)
+}
+
+func (w *SocketLogWriter) Close() {
+	close(w.queue.records)
+	<-w.completed
+}
+
+// Flush blocks until the records logged before it have been sent, or dropped
+// if the socket has failed.
+func (w *SocketLogWriter) Flush() {
+	w.queue.flush()
+}
+
+// SetOverflowPolicy chooses what to do with records logged while the socket is
+// falling behind (chainable).  The timeout is only used by OVERFLOW_TIMEOUT.
+func (w *SocketLogWriter) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) *SocketLogWriter {
+	w.queue.setOverflowPolicy(policy, timeout)
+	return w
+}
 
-// This is the SocketLogWriter's output method
-func (w SocketLogWriter) LogWrite(rec *LogRecord) {
-	w <- rec
+// Dropped returns the number of records dropped, either because the output
+// buffer was full or because the socket could no longer be written to.
+func (w *SocketLogWriter) Dropped() uint64 {
+	return w.queue.droppedRecords()
 }
 
-func (w SocketLogWriter) Close() {
-	close(w)
+// Returns the number of records yet to be sent
+func (w *SocketLogWriter) queued() int {
+	return len(w.queue.records)
 }
 
-func NewSocketLogWriter(proto, hostport string) SocketLogWriter {
+// Records are released once they have been sent
+func (w *SocketLogWriter) releases() bool {
+	return true
+}
+
+func NewSocketLogWriter(proto, hostport string) *SocketLogWriter {
 	sock, err := net.Dial(proto, hostport)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "NewSocketLogWriter(%q): %s\n", hostport, err)
 		return nil
 	}
 
-	w := SocketLogWriter(make(chan *LogRecord, LogBufferLength))
+	w := &SocketLogWriter{
+		queue:     newRecordQueue(),
+		completed: make(chan int),
+	}
 
 	go func() {
 		defer func() {
 			if sock != nil && proto == "tcp" {
 				sock.Close()
 			}
+			close(w.completed)
 		}()
 
-		for rec := range w {
+		write := func(rec *LogRecord) {
+			// Once the socket has failed, drop everything so that we don't block
+			if sock == nil {
+				w.queue.drop()
+				return
+			}
+
 			// Marshall into JSON
 			js, err := json.Marshal(rec)
 			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
+				fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s\n", hostport, err)
 				return
 			}
 
 			_, err = sock.Write(js)
 			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
-				return
+				fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s\n", hostport, err)
+				sock.Close()
+				sock = nil
 			}
 		}
+
+		w.queue.drain(write)
 	}()
 
 	return w
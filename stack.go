@@ -0,0 +1,94 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// The maximum number of stack frames captured for a record
+const maxStackDepth = 64
+
+// Escapes a stack trace for XML, leaving its newlines and tabs intact
+var stackXMLEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// WithStackLevel returns a copy of log which captures the stack trace of the
+// caller for each record logged at or above lvl, e.g. ERROR.  The trace is
+// stored in the record's Stack, and is rendered by the %K format code, by the
+// ConsoleLogWriter and by NewXMLLogWriter.  Stacks are also captured for the
+// records of Log, of a SlogHandler and of the Writer of log.
+func (log Logger) WithStackLevel(lvl Level) Logger {
+	log.stackLevel = lvl
+	log.captureStack = true
+	return log
+}
+
+// WithoutStack returns a copy of log which does not capture stack traces.
+func (log Logger) WithoutStack() Logger {
+	log.captureStack = false
+	return log
+}
+
+// Reports whether a stack trace is captured for records at lvl
+func (log Logger) wantStack(lvl Level) bool {
+	return log.captureStack && lvl >= log.stackLevel
+}
+
+// Capture the stack of the caller skip frames above the caller of stack (e.g.
+// 2 from intLogf, for intLogf and the Logger method), if the level of the
+// record calls for it.  Frames requested with WithCallerSkip are also skipped.
+func (log Logger) stack(lvl Level, skip int) string {
+	if !log.wantStack(lvl) {
+		return ""
+	}
+
+	// Skip runtime.Callers and stack as well
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(2+skip+log.callerSkip, pcs[:])
+	return formatCallers(pcs[:n])
+}
+
+// Render the stack trace of the program counters returned by runtime.Callers
+func formatCallers(pcs []uintptr) string {
+	if len(pcs) == 0 {
+		return ""
+	}
+	frames := runtime.CallersFrames(pcs)
+	frame, more := frames.Next()
+	return formatStack(frame, frames, more)
+}
+
+// Render the stack trace of first and the frames after it.  Each frame is
+// rendered as its function, followed by its file and line on the next line,
+// indented with a tab.
+func formatStack(first runtime.Frame, frames *runtime.Frames, more bool) string {
+	out := bytes.NewBuffer(make([]byte, 0, 1024))
+	for frame := first; ; frame, more = frames.Next() {
+		if out.Len() > 0 {
+			out.WriteByte('\n')
+		}
+		out.WriteString(frame.Function)
+		out.WriteString("\n\t")
+		out.WriteString(frame.File)
+		out.WriteByte(':')
+		out.WriteString(strconv.Itoa(frame.Line))
+		if !more {
+			break
+		}
+	}
+	return out.String()
+}
+
+// Render the stack trace of the record as a <stack> element on its own line,
+// indented to match the records written by NewXMLLogWriter.
+func (rec *LogRecord) writeStackXML(out *bytes.Buffer) {
+	if len(rec.Stack) == 0 {
+		return
+	}
+	out.WriteString("\n\t\t<stack>")
+	stackXMLEscaper.WriteString(out, rec.Stack)
+	out.WriteString("</stack>")
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"io"
+	stdlog "log"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// A stdlogWriter turns the lines written to it into records of a Logger
+type stdlogWriter struct {
+	log Logger
+	lvl Level
+}
+
+// Writer returns an io.Writer which logs each line written to it as a record
+// at lvl, e.g. to capture the output of the standard log package:
+//
+//	log.SetFlags(0)
+//	log.SetOutput(log4go.Global.Writer(log4go.INFO))
+//
+// The source of each record is the caller of the standard log package, if the
+// line was written by it, and is otherwise empty.
+func (log Logger) Writer(lvl Level) io.Writer {
+	return &stdlogWriter{log, lvl}
+}
+
+// StandardLogger returns a *log.Logger from the standard library which logs
+// each line at lvl, e.g. for http.Server.ErrorLog.
+func (log Logger) StandardLogger(lvl Level) *stdlog.Logger {
+	return stdlog.New(log.Writer(lvl), "", 0)
+}
+
+func (w *stdlogWriter) Write(p []byte) (int, error) {
+	if w.log.skip(w.lvl) {
+		return len(p), nil
+	}
+
+	now := time.Now()
+	pc, src, stack := w.caller()
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		rec := pooledRecord()
+		rec.Level, rec.Created, rec.Source, rec.Message = w.lvl, now, src, string(line)
+		rec.Fields, rec.Stack, rec.pc = w.log.fields, stack, pc
+		w.log.dispatch(rec)
+	}
+	return len(p), nil
+}
+
+// Find the first caller outside of the standard log packages, skipping any
+// further frames requested with WithCallerSkip, and capture its stack if the
+// level calls for it
+func (w *stdlogWriter) caller() (pc uintptr, src, stack string) {
+	wantStack := w.log.wantStack(w.lvl)
+	if w.log.sourceFormat == SOURCE_NONE && !wantStack {
+		return 0, "", ""
+	}
+
+	// Skip runtime.Callers, caller and Write
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	inLog, skip := false, w.log.callerSkip
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, "log.") || strings.HasPrefix(frame.Function, "log/") {
+			inLog = true
+		} else if inLog {
+			if skip == 0 {
+				if w.log.sourceFormat != SOURCE_NONE {
+					pc, src = frame.PC+1, w.log.source(frame)
+				}
+				if wantStack {
+					stack = formatStack(frame, frames, more)
+				}
+				return pc, src, stack
+			}
+			skip--
+		}
+		if !more || !inLog {
+			return 0, "", ""
+		}
+	}
+}
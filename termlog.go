@@ -3,9 +3,10 @@
 package log4go
 
 import (
-	"fmt"
+	"bytes"
 	"io"
 	"os"
+	"time"
 )
 
 var stdout io.Writer = os.Stdout
@@ -19,46 +20,116 @@ type ConsoleLogWriter interface {
 	run(out io.Writer)
 	LogWrite(rec *LogRecord)
 	Close()
+	Flush()
+	SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration)
+	SetFormatter(f Formatter)
+	Dropped() uint64
 }
 
 // This is the standard writer that prints to standard output.
 type ConsoleLogWriterImp struct {
-	records   chan *LogRecord
+	queue     *recordQueue
 	completed chan int
+	format    *consoleFormat
+}
+
+// The Formatter of a ConsoleLogWriter, which is shared by its copies
+type consoleFormat struct {
+	formatter Formatter
 }
 
 // This creates a new ConsoleLogWriter
 func NewConsoleLogWriter() ConsoleLogWriter {
 	writer := ConsoleLogWriterImp{
-		records:   make(chan *LogRecord, LogBufferLength),
+		queue:     newRecordQueue(),
 		completed: make(chan int),
+		format:    &consoleFormat{consoleFormatter{}},
 	}
 	go writer.run(stdout)
 	return writer
 }
 
-func (w ConsoleLogWriterImp) run(out io.Writer) {
-	var timestr string
-	var timestrAt int64
+// The default format of a ConsoleLogWriter: the time, level, message and fields
+// of each record, followed by its stack trace on the lines after it
+type consoleFormatter struct{}
 
-	for rec := range w.records {
-		if at := rec.Created.UnixNano() / 1e9; at != timestrAt {
-			timestr, timestrAt = rec.Created.Format("01/02/06 15:04:05"), at
+func (consoleFormatter) FormatRecord(out *bytes.Buffer, rec *LogRecord) {
+	var scratch [32]byte
+	out.WriteByte('[')
+	out.Write(rec.Created.AppendFormat(scratch[:0], "01/02/06 15:04:05"))
+	out.WriteString("] [")
+	out.WriteString(rec.Level.String())
+	out.WriteString("] ")
+	out.WriteString(rec.Message)
+	if len(rec.Fields) > 0 {
+		out.WriteByte(' ')
+		rec.Fields.writeText(out)
+	}
+	out.WriteByte('\n')
+	if len(rec.Stack) > 0 {
+		out.WriteString(rec.Stack)
+		out.WriteByte('\n')
+	}
+}
+
+func (w ConsoleLogWriterImp) run(out io.Writer) {
+	buf := new(bytes.Buffer)
+	write := func(rec *LogRecord) {
+		var formatter Formatter = consoleFormatter{}
+		if w.format != nil {
+			formatter = w.format.formatter
 		}
-		fmt.Fprint(out, "[", timestr, "] [", levelStrings[rec.Level], "] ", rec.Message, "\n")
+		buf.Reset()
+		formatter.FormatRecord(buf, rec)
+		out.Write(buf.Bytes())
 	}
+
+	w.queue.drain(write)
 	close(w.completed)
 }
 
 // This is the ConsoleLogWriter's output method.  This will block if the output
-// buffer is full.
+// buffer is full, unless an OverflowPolicy has been set.
 func (w ConsoleLogWriterImp) LogWrite(rec *LogRecord) {
-	w.records <- rec
+	w.queue.put(rec)
 }
 
 // Close stops the logger from sending messages to standard output.  Attempts to
 // send log messages to this logger after a Close have undefined behavior.
 func (w ConsoleLogWriterImp) Close() {
-	close(w.records)
+	close(w.queue.records)
 	<-w.completed
 }
+
+// Flush blocks until every record logged before it has been written.
+func (w ConsoleLogWriterImp) Flush() {
+	w.queue.flush()
+}
+
+// SetOverflowPolicy determines what happens to records logged while the output
+// buffer is full.  The timeout is only used by OVERFLOW_TIMEOUT.
+func (w ConsoleLogWriterImp) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) {
+	w.queue.setOverflowPolicy(policy, timeout)
+}
+
+// SetFormatter replaces the console format with a Formatter, such as a
+// LogfmtFormatter.  Must be called before the first log message is written.
+func (w ConsoleLogWriterImp) SetFormatter(f Formatter) {
+	w.format.formatter = f
+}
+
+// Dropped returns the number of records dropped because the output buffer was
+// full.
+func (w ConsoleLogWriterImp) Dropped() uint64 {
+	return w.queue.droppedRecords()
+}
+
+// Returns the number of records waiting to be written
+func (w ConsoleLogWriterImp) queued() int {
+	return len(w.queue.records)
+}
+
+// Records are released once they have been written
+func (w ConsoleLogWriterImp) releases() bool {
+	return true
+}
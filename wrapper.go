@@ -3,10 +3,12 @@
 package log4go
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 var (
@@ -27,11 +29,51 @@ func AddFilter(name string, lvl Level, writer LogWriter) {
 	Global.AddFilter(name, lvl, writer)
 }
 
+// Wrapper for (*Logger).RemoveFilter
+func RemoveFilter(name string) bool {
+	return Global.RemoveFilter(name)
+}
+
+// Wrapper for (*Logger).SetLevel
+func SetLevel(name string, lvl Level) bool {
+	return Global.SetLevel(name, lvl)
+}
+
+// Wrapper for (*Logger).With
+func With(keyvals ...interface{}) Logger {
+	return Global.With(keyvals...)
+}
+
+// Wrapper for (*Logger).GetLogger
+func GetLogger(name string) Logger {
+	return Global.GetLogger(name)
+}
+
+// Wrapper for (*Logger).SetLoggerLevel
+func SetLoggerLevel(name string, lvl Level) {
+	Global.SetLoggerLevel(name, lvl)
+}
+
+// Wrapper for (*Logger).Flush
+func Flush() {
+	Global.Flush()
+}
+
 // Wrapper for (*Logger).Close (closes and removes all logwriters)
 func Close() {
 	Global.Close()
 }
 
+// Wrapper for (*Logger).CloseWithTimeout
+func CloseWithTimeout(d time.Duration) error {
+	return Global.CloseWithTimeout(d)
+}
+
+// Wrapper for (*Logger).CloseContext
+func CloseContext(ctx context.Context) error {
+	return Global.CloseContext(ctx)
+}
+
 func Crash(args ...interface{}) {
 	if len(args) > 0 {
 		Global.intLogf(CRITICAL, strings.Repeat(" %v", len(args))[1:], args...)
@@ -276,3 +318,205 @@ func Critical(arg0 interface{}, args ...interface{}) error {
 	}
 	return nil
 }
+
+// Send a log message manually, attaching any fields extracted from ctx
+// Wrapper for (*Logger).LogCtx
+func LogCtx(ctx context.Context, lvl Level, source, message string) {
+	Global.LogCtx(ctx, lvl, source, message)
+}
+
+// Send a formatted log message easily, attaching any fields extracted from ctx
+// Wrapper for (*Logger).LogfCtx
+func LogfCtx(ctx context.Context, lvl Level, format string, args ...interface{}) {
+	if Global.skip(lvl) {
+		return
+	}
+	Global.withContext(ctx).intLogf(lvl, format, args...)
+}
+
+// Utility for finest log messages, attaching any fields extracted from ctx
+// Wrapper for (*Logger).FinestCtx
+func FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = FINEST
+	)
+	if Global.skip(lvl) {
+		return
+	}
+	log := Global.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// Utility for fine log messages, attaching any fields extracted from ctx
+// Wrapper for (*Logger).FineCtx
+func FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = FINE
+	)
+	if Global.skip(lvl) {
+		return
+	}
+	log := Global.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// Utility for debug log messages, attaching any fields extracted from ctx
+// Wrapper for (*Logger).DebugCtx
+func DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = DEBUG
+	)
+	if Global.skip(lvl) {
+		return
+	}
+	log := Global.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// Utility for trace log messages, attaching any fields extracted from ctx
+// Wrapper for (*Logger).TraceCtx
+func TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = TRACE
+	)
+	if Global.skip(lvl) {
+		return
+	}
+	log := Global.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// Utility for info log messages, attaching any fields extracted from ctx
+// Wrapper for (*Logger).InfoCtx
+func InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = INFO
+	)
+	if Global.skip(lvl) {
+		return
+	}
+	log := Global.withContext(ctx)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		log.intLogc(lvl, first)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// Utility for warn log messages, attaching any fields extracted from ctx
+// Wrapper for (*Logger).WarnCtx
+func WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = WARNING
+	)
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...)
+	}
+	if !Global.skip(lvl) {
+		Global.withContext(ctx).intLogf(lvl, "%s", msg)
+	}
+	return errors.New(msg)
+}
+
+// Utility for error log messages, attaching any fields extracted from ctx
+// Wrapper for (*Logger).ErrorCtx
+func ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = ERROR
+	)
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...)
+	}
+	if !Global.skip(lvl) {
+		Global.withContext(ctx).intLogf(lvl, "%s", msg)
+	}
+	return errors.New(msg)
+}
+
+// Utility for critical log messages, attaching any fields extracted from ctx
+// Wrapper for (*Logger).CriticalCtx
+func CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = CRITICAL
+	)
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (no other arguments used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...)
+	}
+	if !Global.skip(lvl) {
+		Global.withContext(ctx).intLogf(lvl, "%s", msg)
+	}
+	return errors.New(msg)
+}